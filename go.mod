@@ -3,8 +3,9 @@ module buff163Parser
 go 1.20
 
 require (
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/net v0.15.0 // indirect
-	golang.org/x/sys v0.12.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/net v0.15.0
+	gopkg.in/yaml.v2 v2.4.0
 )
+
+require golang.org/x/sys v0.12.0 // indirect
@@ -1,30 +1,82 @@
 package main
 
 import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/cassette"
 	"buff163Parser/pkg/configManager"
 	"buff163Parser/pkg/cookieParsing"
 	"buff163Parser/pkg/logger"
 	"buff163Parser/pkg/nonCookieParsing"
+	"buff163Parser/pkg/upstream"
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 )
 
 func main() {
+	record := flag.String("record", "", "directory to save every buff163 request and response to, as cassette files")
+	replay := flag.String("replay", "", "directory of cassette files to serve buff163 responses from instead of the network. "+
+		"Only buff163 traffic is replayed, the backend must still be reachable and the API key set")
+	flag.Parse()
+	if *record != "" && *replay != "" {
+		fmt.Println("--record and --replay can't be used together")
+		return
+	}
+
 	config, err := configManager.LoadConfig("config.yaml")
 	if err != nil {
 		fmt.Printf("Error loading config: %s\n", err)
 		return
 	}
-	//backendAPIKey := os.Getenv(config.BackendAPIKeyEnv)
-	//if backendAPIKey == "" {
-	//	fmt.Println("No backend API key provided!")
-	//	return
-	//}
+	backendAPIKey := os.Getenv(config.BackendAPIKeyEnv)
+	if backendAPIKey == "" {
+		fmt.Println("No backend API key provided!")
+		return
+	}
 
 	logger.Log.Info("Config was successfully loaded")
 
 	logger.Log.Infof("%s mode was launched!", config.Mode)
 
+	authenticator := backend.NewAuthenticator(&config.Backend, backendAPIKey)
+	if _, err := authenticator.Token(context.Background()); err != nil {
+		logger.Log.WithError(err).Error("Authentication with backend failed")
+		return
+	}
+	logger.Log.Info("Authenticated with backend")
+	backendClient := backend.NewClient(&config.Backend, authenticator)
+	buff, err := upstream.New(config.Buff)
+	if err != nil {
+		logger.Log.WithError(err).Error("Invalid buff config")
+		return
+	}
+	switch {
+	case *record != "":
+		recorder, err := cassette.NewRecorder(*record)
+		if err != nil {
+			logger.Log.WithError(err).Error("Recording of buff163 responses failed")
+			return
+		}
+		buff.Transport = recorder.Wrap
+		logger.Log.Infof("Recording buff163 responses to %s", *record)
+	case *replay != "":
+		player, err := cassette.NewPlayer(*replay)
+		if err != nil {
+			logger.Log.WithError(err).Error("Replaying of buff163 responses failed")
+			return
+		}
+		buff.Transport = player.Wrap
+		logger.Log.Infof("Replaying buff163 responses from %s, backend requests still go to %s", *replay, config.Backend.BaseURL)
+	}
+
+	// On SIGINT/SIGTERM the parsers stop taking new work, finish or abort in-flight items and release accounts
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	var wg sync.WaitGroup
 
 	switch config.Mode {
@@ -32,7 +84,7 @@ func main() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := nonCookieParsing.StartNonCookieParsing(); err != nil {
+			if err := nonCookieParsing.StartNonCookieParsing(ctx, config, backendClient, buff); err != nil {
 				logger.Log.WithError(err).Errorf("Starting of nonCookieParsing failed")
 			}
 		}()
@@ -40,7 +92,7 @@ func main() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := cookieParsing.StartCookieParsing(); err != nil {
+			if err := cookieParsing.StartCookieParsing(ctx, config, backendClient, buff); err != nil {
 				logger.Log.WithError(err).Errorf("Starting of cookieParsing failed")
 			}
 		}()
@@ -48,14 +100,14 @@ func main() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := nonCookieParsing.StartNonCookieParsing(); err != nil {
+			if err := nonCookieParsing.StartNonCookieParsing(ctx, config, backendClient, buff); err != nil {
 				logger.Log.WithError(err).Errorf("Starting of nonCookieParsing failed")
 			}
 		}()
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := cookieParsing.StartCookieParsing(); err != nil {
+			if err := cookieParsing.StartCookieParsing(ctx, config, backendClient, buff); err != nil {
 				logger.Log.WithError(err).Errorf("Starting of cookieParsing failed")
 			}
 		}()
@@ -63,4 +115,5 @@ func main() {
 		fmt.Println("Unknown mode.")
 	}
 	wg.Wait()
+	logger.Log.Info("Parser stopped")
 }
@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"buff163Parser/pkg/configManager"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTokenRefreshBefore is used when backend.token_refresh_before isn't set in config
+const defaultTokenRefreshBefore = time.Minute
+
+type signInRequest struct {
+	APIKey string `json:"api_key"`
+}
+
+type LoginResponse struct {
+	Token string `json:"token"`
+}
+
+// Authenticator is a TokenSource that signs in to the backend with an API key and keeps the JWT fresh.
+// The token is refreshed before it expires and dropped when the backend rejects it with 401.
+type Authenticator struct {
+	config        *configManager.BackendConfig
+	httpClient    *http.Client
+	apiKey        string
+	refreshBefore time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time // zero if the token has no exp claim
+}
+
+func NewAuthenticator(config *configManager.BackendConfig, apiKey string) *Authenticator {
+	refreshBefore := config.TokenRefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = defaultTokenRefreshBefore
+	}
+	return &Authenticator{
+		config:        config,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		apiKey:        apiKey,
+		refreshBefore: refreshBefore,
+	}
+}
+
+// Token returns the current token, signing in again if there is none or it's about to expire
+func (a *Authenticator) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && (a.expiresAt.IsZero() || time.Until(a.expiresAt) > a.refreshBefore) {
+		return a.token, nil
+	}
+
+	token, err := a.signIn(ctx)
+	if err != nil {
+		return "", err
+	}
+	expiresAt, err := tokenExpiry(token)
+	if err != nil {
+		return "", fmt.Errorf("error parsing token received from backend: %v", err)
+	}
+
+	a.token = token
+	a.expiresAt = expiresAt
+	return a.token, nil
+}
+
+// Invalidate drops the token if it's still the current one, so the next Token call signs in again.
+// Passing the rejected token prevents concurrent requests from dropping a token that was just refreshed.
+func (a *Authenticator) Invalidate(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == token {
+		a.token = ""
+		a.expiresAt = time.Time{}
+	}
+}
+
+// signIn gets a new JWT token from the backend
+func (a *Authenticator) signIn(ctx context.Context) (string, error) {
+	jsonData, err := json.Marshal(signInRequest{APIKey: a.apiKey})
+	if err != nil {
+		return "", err
+	}
+
+	signInURL := a.config.URL(configManager.EndpointSignIn)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, signInURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return "", &RequestError{Method: http.MethodPost, URL: signInURL, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return "", &RequestError{Method: http.MethodPost, URL: signInURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", &RequestError{Method: http.MethodPost, URL: signInURL, Err: fmt.Errorf("error reading response body: %v", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Method: http.MethodPost, URL: signInURL, StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	var loginResponse LoginResponse
+	if err := json.Unmarshal(bodyBytes, &loginResponse); err != nil {
+		return "", &DecodeError{Method: http.MethodPost, URL: signInURL, Err: err}
+	}
+	if loginResponse.Token == "" {
+		return "", errors.New("backend returned an empty token")
+	}
+
+	return loginResponse.Token, nil
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying the signature, it's the backend's job.
+// A token without exp claim returns zero time.
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("token has %d parts, expected 3", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error decoding token payload: %v", err)
+	}
+
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("error decoding token claims: %v", err)
+	}
+	if claims.Exp == nil {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(int64(*claims.Exp), 0), nil
+}
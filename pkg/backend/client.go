@@ -0,0 +1,254 @@
+package backend
+
+import (
+	"buff163Parser/pkg/configManager"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// TokenSource supplies the JWT token attached to every backend request
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token. An empty token sends no Authorization header.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// invalidatingTokenSource is a TokenSource that can drop a token rejected by the backend, like Authenticator
+type invalidatingTokenSource interface {
+	TokenSource
+	Invalidate(token string)
+}
+
+// Client is a typed client of the backend API
+type Client struct {
+	config     *configManager.BackendConfig
+	httpClient *http.Client
+	tokens     TokenSource
+}
+
+func NewClient(config *configManager.BackendConfig, tokens TokenSource) *Client {
+	if tokens == nil {
+		tokens = StaticToken("")
+	}
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		tokens:     tokens,
+	}
+}
+
+type response struct {
+	method     string
+	url        string
+	statusCode int
+	body       []byte
+}
+
+func (r *response) statusError() *StatusError {
+	return &StatusError{Method: r.method, URL: r.url, StatusCode: r.statusCode, Body: string(r.body)}
+}
+
+func (r *response) decode(out interface{}) error {
+	if err := json.Unmarshal(r.body, out); err != nil {
+		return &DecodeError{Method: r.method, URL: r.url, Err: err}
+	}
+	return nil
+}
+
+// do sends a request to the endpoint and reads the whole response. It's the only place where auth headers are set.
+// If the backend rejects the token with 401, the token is invalidated and the request is retried once.
+func (c *Client) do(ctx context.Context, method, endpoint string, payload interface{}, segments ...string) (*response, error) {
+	requestURL := c.config.URL(endpoint, segments...)
+
+	var jsonData []byte
+	if payload != nil {
+		var err error
+		jsonData, err = json.Marshal(payload)
+		if err != nil {
+			return nil, &RequestError{Method: method, URL: requestURL, Err: fmt.Errorf("error marshalling payload: %v", err)}
+		}
+	}
+
+	resp, token, err := c.send(ctx, method, requestURL, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	if invalidating, ok := c.tokens.(invalidatingTokenSource); ok && resp.statusCode == http.StatusUnauthorized {
+		invalidating.Invalidate(token)
+		resp, _, err = c.send(ctx, method, requestURL, jsonData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// send makes a single request and returns the response along with the token it was sent with
+func (c *Client) send(ctx context.Context, method, requestURL string, jsonData []byte) (*response, string, error) {
+	var body io.Reader
+	if jsonData != nil {
+		body = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, "", &RequestError{Method: method, URL: requestURL, Err: err}
+	}
+	if jsonData != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, "", &RequestError{Method: method, URL: requestURL, Err: fmt.Errorf("error getting auth token: %w", err)}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", &RequestError{Method: method, URL: requestURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", &RequestError{Method: method, URL: requestURL, Err: fmt.Errorf("error reading response body: %v", err)}
+	}
+
+	return &response{method: method, url: requestURL, statusCode: resp.StatusCode, body: bodyBytes}, token, nil
+}
+
+// doOK is do that treats every status except 200 as an error
+func (c *Client) doOK(ctx context.Context, method, endpoint string, payload interface{}, segments ...string) (*response, error) {
+	resp, err := c.do(ctx, method, endpoint, payload, segments...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.statusCode != http.StatusOK {
+		return nil, resp.statusError()
+	}
+	return resp, nil
+}
+
+func (c *Client) getIDs(ctx context.Context, endpoint string) ([]string, error) {
+	resp, err := c.doOK(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := resp.decode(&ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (c *Client) getWorkItems(ctx context.Context, endpoint string) ([]WorkItem, error) {
+	resp, err := c.doOK(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	var items []WorkItem
+	if err := resp.decode(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ReserveAccount locks a free buff163 account for the caller. When there are no free accounts
+// it returns *NoAccountsError with the time the backend asks to wait.
+func (c *Client) ReserveAccount(ctx context.Context) (*Account, error) {
+	resp, err := c.do(ctx, http.MethodGet, configManager.EndpointReserveAccount, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.statusCode {
+	case http.StatusOK:
+		account := &Account{}
+		if err := resp.decode(account); err != nil {
+			return nil, err
+		}
+		return account, nil
+	case http.StatusNotFound:
+		waiting := &waitingTimeResponse{}
+		if err := resp.decode(waiting); err != nil {
+			return nil, err
+		}
+		return nil, &NoAccountsError{Message: waiting.Message, WaitingTime: time.Duration(waiting.WaitingTime) * time.Second}
+	default:
+		return nil, resp.statusError()
+	}
+}
+
+// ReleaseAccount returns the account to the backend along with the stats of the session
+func (c *Client) ReleaseAccount(ctx context.Context, release AccountRelease) error {
+	_, err := c.doOK(ctx, http.MethodPost, configManager.EndpointReleaseAccount, release)
+	return err
+}
+
+// ResetAccounts unlocks all buff163 accounts on the backend
+func (c *Client) ResetAccounts(ctx context.Context) error {
+	_, err := c.doOK(ctx, http.MethodGet, configManager.EndpointResetAccounts, nil)
+	return err
+}
+
+// CookieParsingItems returns items that should be parsed with accounts
+func (c *Client) CookieParsingItems(ctx context.Context) ([]WorkItem, error) {
+	return c.getWorkItems(ctx, configManager.EndpointCookieParsingItems)
+}
+
+// MissingBuffIDs returns items that should be parsed without accounts
+func (c *Client) MissingBuffIDs(ctx context.Context) ([]WorkItem, error) {
+	return c.getWorkItems(ctx, configManager.EndpointMissingBuffIDs)
+}
+
+// ParsingProxies returns proxy URLs for nonCookie parsing
+func (c *Client) ParsingProxies(ctx context.Context) ([]string, error) {
+	return c.getIDs(ctx, configManager.EndpointParsingProxies)
+}
+
+// GetItem decodes the stored item with the given goods ID into item
+func (c *Client) GetItem(ctx context.Context, goodsID string, item interface{}) error {
+	resp, err := c.doOK(ctx, http.MethodGet, configManager.EndpointItems, nil, goodsID)
+	if err != nil {
+		return err
+	}
+	return resp.decode(item)
+}
+
+// PostItem creates or updates an item on the backend
+func (c *Client) PostItem(ctx context.Context, item interface{}) error {
+	_, err := c.doOK(ctx, http.MethodPost, configManager.EndpointItems, item)
+	return err
+}
+
+// PostSales sends processed sale records of an item
+func (c *Client) PostSales(ctx context.Context, records interface{}) error {
+	_, err := c.doOK(ctx, http.MethodPost, configManager.EndpointSales, records)
+	return err
+}
+
+// PostHistoricalPrices sends the price history of an item
+func (c *Client) PostHistoricalPrices(ctx context.Context, history interface{}) error {
+	_, err := c.doOK(ctx, http.MethodPost, configManager.EndpointHistoricalPrices, history)
+	return err
+}
+
+// PostListings sends sell order listings of an item with their float, paint seed, stickers and seller
+func (c *Client) PostListings(ctx context.Context, listings interface{}) error {
+	_, err := c.doOK(ctx, http.MethodPost, configManager.EndpointListings, listings)
+	return err
+}
@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+)
+
+// RequestError is returned when the request couldn't be made or its response couldn't be read
+type RequestError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("backend request %s %s failed: %v", e.Method, e.URL, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is returned when the backend responds with a status code the endpoint doesn't expect
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("backend request %s %s returned status %d", e.Method, e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("backend request %s %s returned status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// DecodeError is returned when the response body doesn't match the expected JSON
+type DecodeError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("error decoding response of %s %s: %v", e.Method, e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// NoAccountsError is returned by ReserveAccount when the backend has no free accounts at the moment
+type NoAccountsError struct {
+	Message     string
+	WaitingTime time.Duration
+}
+
+func (e *NoAccountsError) Error() string {
+	return fmt.Sprintf("no accounts available: %s, retry in %s", e.Message, e.WaitingTime)
+}
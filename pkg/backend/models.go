@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"buff163Parser/pkg/games"
+	"encoding/json"
+	"fmt"
+)
+
+type Account struct {
+	ID                       int    `json:"id"`
+	Cookie                   string `json:"cookie"`
+	SteamLinked              bool   `json:"steam_linked"`
+	LastUsedAt               string `json:"last_used_at"`
+	TotalReqsMade            int    `json:"total_reqs_made"`
+	TotalRequestsMadePerHour int    `json:"total_requests_made_per_hour"`
+	OuterItemDelay           int    `json:"outer_item_delay"`
+	InterItemDelay           int    `json:"inter_item_delay"`
+	IsLocked                 bool   `json:"is_locked"`
+	LockedUntil              string `json:"locked_until"`
+	Reqs429                  int    `json:"reqs_429"`
+	BackoffCoeff             int    `json:"backoff_coeff"`
+	Proxy                    string `json:"proxy"`
+	UserAgent                string `json:"user_agent"`
+}
+
+// AccountRelease is the payload of /releaseaccount, sent when the parser is done with an account
+type AccountRelease struct {
+	Account        *Account `json:"account"`
+	SuccessfulReqs int      `json:"successful_reqs"`
+	Reqs429        int      `json:"reqs_429"`
+	IsBanned       bool     `json:"is_banned"`
+	// CookieRotated is true when Account.Cookie holds cookies updated by buff163 during the session
+	CookieRotated bool `json:"cookie_rotated"`
+}
+
+type waitingTimeResponse struct {
+	Message     string `json:"message"`
+	WaitingTime int    `json:"waitingTime"`
+}
+
+// WorkItem is an item to parse. The backend sends either a plain goods ID, which is a CS:GO item,
+// or an object like {"id": "35213", "game": "dota2"}.
+type WorkItem struct {
+	GoodsID string
+	Game    games.Game
+}
+
+func (w *WorkItem) UnmarshalJSON(data []byte) error {
+	var goodsID string
+	if err := json.Unmarshal(data, &goodsID); err == nil {
+		*w = WorkItem{GoodsID: goodsID, Game: games.Default}
+		return nil
+	}
+
+	var item struct {
+		ID   json.Number `json:"id"`
+		Game string      `json:"game"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return fmt.Errorf("work item must be a goods ID or an object with id and game: %v", err)
+	}
+	if item.ID == "" {
+		return fmt.Errorf("work item %s has no id", data)
+	}
+	game, err := games.Parse(item.Game)
+	if err != nil {
+		return fmt.Errorf("work item %s: %v", item.ID, err)
+	}
+	*w = WorkItem{GoodsID: item.ID.String(), Game: game}
+	return nil
+}
@@ -0,0 +1,121 @@
+package buyOrders
+
+import (
+	"buff163Parser/pkg/prices"
+	"buff163Parser/pkg/schemaDrift"
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type Response struct {
+	Code string `json:"code"`
+	Data struct {
+		Items []struct {
+			ID       string `json:"id"`
+			Price    string `json:"price"`
+			Num      int    `json:"num"`
+			UserID   string `json:"user_id"`
+			Specific []struct {
+				Type   string        `json:"type"`
+				Values []interface{} `json:"values"`
+			} `json:"specific"`
+		} `json:"items"`
+	} `json:"data"`
+}
+
+// Schema is the expected shape of a buy_order response
+var Schema = schemaDrift.Object(schemaDrift.Fields{
+	"code": schemaDrift.Required(schemaDrift.String()),
+	"msg":  schemaDrift.Any(),
+	"data": schemaDrift.Required(schemaDrift.Object(schemaDrift.Fields{
+		"items": schemaDrift.Required(schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+			"id":      schemaDrift.String(),
+			"price":   schemaDrift.Required(schemaDrift.String()),
+			"num":     schemaDrift.Required(schemaDrift.Number()),
+			"user_id": schemaDrift.String(),
+			"specific": schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+				"type":   schemaDrift.Required(schemaDrift.String()),
+				"values": schemaDrift.Array(schemaDrift.Any()),
+			})),
+		}))),
+	})),
+})
+
+// BuyOrder is a single order of the buy order book
+type BuyOrder struct {
+	ID             string            `json:"id"`
+	Price          string            `json:"price"`
+	PriceConverted *prices.Converted `json:"price_converted,omitempty"`
+	Quantity       int               `json:"quantity"`
+	BuyerID        string            `json:"buyer_id"`
+	// Constraints limit the items the order buys, e.g. a paintwear range or paint seeds. Empty for any item.
+	Constraints []Constraint `json:"constraints,omitempty"`
+}
+
+type Constraint struct {
+	// Type is the constraint kind as named by buff163: paintwear, paintseed, tier etc.
+	Type   string   `json:"type"`
+	Values []string `json:"values"`
+}
+
+// CodeError is returned when buff163 answers with a code other than OK, e.g. "Action Forbidden"
+type CodeError struct {
+	Code string
+}
+
+func (e *CodeError) Error() string {
+	return fmt.Sprintf("buy order response code is %q", e.Code)
+}
+
+// Parse decodes a buy_order response into the buy order book
+func Parse(body []byte) ([]BuyOrder, error) {
+	// Numbers in constraint values are kept as written, large paint seeds don't fit float64
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var response Response
+	if err := decoder.Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding buy orders: %v", err)
+	}
+	if response.Code != "OK" {
+		return nil, &CodeError{Code: response.Code}
+	}
+
+	book := make([]BuyOrder, 0, len(response.Data.Items))
+	for _, item := range response.Data.Items {
+		order := BuyOrder{
+			ID:       item.ID,
+			Price:    item.Price,
+			Quantity: item.Num,
+			BuyerID:  item.UserID,
+		}
+		for _, specific := range item.Specific {
+			constraint := Constraint{Type: specific.Type}
+			for _, value := range specific.Values {
+				constraint.Values = append(constraint.Values, formatValue(value))
+			}
+			order.Constraints = append(order.Constraints, constraint)
+		}
+		book = append(book, order)
+	}
+	return book, nil
+}
+
+// formatValue renders a constraint value as buff163 wrote it
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Normalize fills normalized prices of the book, its prices are in the converter source currency
+func Normalize(book []BuyOrder, converter *prices.Converter) {
+	for i := range book {
+		book[i].PriceConverted = converter.ConvertSource(book[i].Price)
+	}
+}
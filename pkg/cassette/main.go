@@ -0,0 +1,293 @@
+package cassette
+
+import (
+	"buff163Parser/pkg/logger"
+	"buff163Parser/pkg/proxyDialer"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+var cassetteLogger = logger.Log.WithField("context", "cassette")
+
+// Redacted replaces values of cookies and credentials in cassettes
+const Redacted = "[REDACTED]"
+
+// redactedHeaders are request headers whose values are never written to a cassette
+var redactedHeaders = []string{"Cookie", "Authorization", "Proxy-Authorization"}
+
+// Interaction is a single request and its response, stored as a cassette file
+type Interaction struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	// Proxy the request was sent through, scheme://host:port without credentials
+	Proxy    string    `json:"proxy,omitempty"`
+	Request  Request   `json:"request"`
+	Response *Response `json:"response,omitempty"`
+	// Error is set instead of Response when the request failed
+	Error string `json:"error,omitempty"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+	// BodyBase64 is true when Body holds base64 of a body that isn't valid UTF-8
+	BodyBase64 bool `json:"body_base64,omitempty"`
+}
+
+// key matches a replayed request to recorded ones. The host is left out, so cassettes recorded
+// against buff.163.com can be replayed with another base URL.
+func key(method string, requestURL *url.URL) string {
+	return method + " " + requestURL.RequestURI()
+}
+
+// redactURL removes user info of the URL
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
+
+func redactRequestHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, Redacted)
+		}
+	}
+	return redacted
+}
+
+// redactResponseHeader keeps names and attributes of cookies set by the response and redacts their values
+func redactResponseHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	setCookies := redacted.Values("Set-Cookie")
+	redacted.Del("Set-Cookie")
+	for _, setCookie := range setCookies {
+		name, rest, _ := strings.Cut(setCookie, "=")
+		attributes := ""
+		if _, attrs, ok := strings.Cut(rest, ";"); ok {
+			attributes = ";" + attrs
+		}
+		redacted.Add("Set-Cookie", name+"="+Redacted+attributes)
+	}
+	return redacted
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Recorder saves every request sent through the transports it wraps to a directory, one cassette file
+// per request, named so that sorting gives the recording order. Cookies and credentials are redacted.
+type Recorder struct {
+	dir string
+	seq atomic.Int64
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cassette directory: %v", err)
+	}
+	return &Recorder{dir: dir}, nil
+}
+
+// Wrap returns a transport that sends requests with next and records them, it's meant for upstream.Buff Transport
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{recorder: r, next: next}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	interaction := Interaction{
+		RecordedAt: time.Now().UTC(),
+		Request:    Request{Method: req.Method, URL: redactURL(req.URL), Header: redactRequestHeader(req.Header)},
+	}
+	// The connection tells the proxy of any scheme, including socks5 ones dialed by the transport
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		interaction.Proxy = proxyDialer.ProxyOf(info.Conn)
+	}}
+	tracedReq := req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	if transport, ok := t.next.(*http.Transport); ok && transport.Proxy != nil {
+		// Requests that fail before a connection is made still name their HTTP proxy
+		if proxyURL, err := transport.Proxy(req); err == nil && proxyURL != nil {
+			interaction.Proxy = proxyDialer.Address(proxyURL)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(tracedReq)
+	if err != nil {
+		interaction.Error = err.Error()
+		t.recorder.save(req.URL, interaction)
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		interaction.Error = err.Error()
+		t.recorder.save(req.URL, interaction)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction.Response = &Response{Status: resp.StatusCode, Header: redactResponseHeader(resp.Header), Body: string(body)}
+	if !utf8.Valid(body) {
+		interaction.Response.Body = base64.StdEncoding.EncodeToString(body)
+		interaction.Response.BodyBase64 = true
+	}
+	t.recorder.save(req.URL, interaction)
+	return resp, nil
+}
+
+func (t *recordingTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// save writes the cassette file, a failure is logged and doesn't fail the request
+func (r *Recorder) save(requestURL *url.URL, interaction Interaction) {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		cassetteLogger.WithError(err).Error("Error encoding cassette")
+		return
+	}
+	name := unsafeNameChars.ReplaceAllString(path.Base(requestURL.Path), "_")
+	file := filepath.Join(r.dir, fmt.Sprintf("%08d_%s.json", r.seq.Add(1), name))
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		cassetteLogger.WithError(err).Errorf("Error writing cassette %s", file)
+	}
+}
+
+// NoCassetteError is returned by a replaying transport for a request that wasn't recorded,
+// or was requested more times than it was recorded
+type NoCassetteError struct {
+	Method string
+	URL    string
+}
+
+func (e *NoCassetteError) Error() string {
+	return fmt.Sprintf("no recorded response for %s %s", e.Method, e.URL)
+}
+
+// Player serves responses from cassette files instead of the network. Responses recorded for the same
+// request are served in the recording order, each once.
+type Player struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+}
+
+// NewPlayer loads cassette files of the directory
+func NewPlayer(dir string) (*Player, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no cassettes found in %s", dir)
+	}
+	sort.Strings(files)
+
+	player := &Player{interactions: make(map[string][]Interaction)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading cassette: %v", err)
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("error decoding cassette %s: %v", file, err)
+		}
+		requestURL, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing URL of cassette %s: %v", file, err)
+		}
+		k := key(interaction.Request.Method, requestURL)
+		player.interactions[k] = append(player.interactions[k], interaction)
+	}
+	cassetteLogger.Infof("Loaded %d cassettes from %s", len(files), dir)
+	return player, nil
+}
+
+// Wrap returns a transport that answers requests from the cassettes, next isn't used.
+// It's meant for upstream.Buff Transport.
+func (p *Player) Wrap(next http.RoundTripper) http.RoundTripper {
+	return p
+}
+
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	k := key(req.Method, req.URL)
+	p.mu.Lock()
+	recorded := p.interactions[k]
+	if len(recorded) > 0 {
+		p.interactions[k] = recorded[1:]
+	}
+	p.mu.Unlock()
+	if len(recorded) == 0 {
+		return nil, &NoCassetteError{Method: req.Method, URL: redactURL(req.URL)}
+	}
+
+	interaction := recorded[0]
+	if interaction.Error != "" || interaction.Response == nil {
+		return nil, fmt.Errorf("recorded error: %s", interaction.Error)
+	}
+	body := []byte(interaction.Response.Body)
+	if interaction.Response.BodyBase64 {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(interaction.Response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding recorded body: %v", err)
+		}
+	}
+
+	header := interaction.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// Cookies with redacted values would replace the account cookies
+	setCookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, setCookie := range setCookies {
+		if !strings.Contains(setCookie, "="+Redacted) {
+			header.Add("Set-Cookie", setCookie)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode:    interaction.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
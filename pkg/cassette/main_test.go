@@ -0,0 +1,159 @@
+package cassette_test
+
+import (
+	"buff163Parser/pkg/cassette"
+	"buff163Parser/pkg/mockBuff"
+	"buff163Parser/pkg/proxyDialer"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, client *http.Client, link string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Cookie", "session=account-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	buff, err := mockBuff.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buff.Close()
+	proxyURL, err := proxyDialer.Parse(strings.Replace(buff.ProxyURL(), "http://", "http://proxy-account:proxy-secret@", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, err := proxyDialer.NewTransport(proxyURL, proxyDialer.Timeouts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	recorder, err := cassette.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording := &http.Client{Transport: recorder.Wrap(buff.WrapTransport(proxied))}
+	goodsPage := buff.URL() + "/goods/1001"
+	goodsInfo := buff.URL() + mockBuff.PathGoodsInfo + "?game=csgo&goods_id=1001"
+	_, recordedPage := get(t, recording, goodsPage)
+	_, recordedInfo := get(t, recording, goodsInfo)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("recorded %d cassettes, want 2", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"account-secret", "proxy-account", "proxy-secret", "mock-1001"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("cassette %s contains %q", file, secret)
+			}
+		}
+		if !strings.Contains(string(data), cassette.Redacted) {
+			t.Errorf("cassette %s has nothing redacted", file)
+		}
+		if !strings.Contains(string(data), `"proxy": "`+buff.ProxyURL()+`"`) {
+			t.Errorf("cassette %s doesn't name the proxy", file)
+		}
+	}
+
+	// Replaying needs no network, the server is gone
+	buff.Close()
+	player, err := cassette.NewPlayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaying := &http.Client{Transport: player.Wrap(proxied)}
+	resp, replayedPage := get(t, replaying, goodsPage)
+	if replayedPage != recordedPage {
+		t.Errorf("replayed goods page %q, recorded %q", replayedPage, recordedPage)
+	}
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) != 0 {
+		t.Errorf("replayed redacted cookies %v", cookies)
+	}
+	resp, replayedInfo := get(t, replaying, goodsInfo)
+	if resp.StatusCode != http.StatusOK || replayedInfo != recordedInfo {
+		t.Errorf("replayed goods info with status %d differs from the recorded one", resp.StatusCode)
+	}
+
+	// Each recorded response is served once
+	_, err = replaying.Get(goodsInfo)
+	var noCassetteErr *cassette.NoCassetteError
+	if !errors.As(err, &noCassetteErr) {
+		t.Errorf("replaying a request more times than recorded returned %v, want NoCassetteError", err)
+	}
+}
+
+func TestRecordsSOCKSProxy(t *testing.T) {
+	buff, err := mockBuff.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buff.Close()
+	proxyURL, err := proxyDialer.Parse(strings.Replace(buff.SOCKSProxyURL(), "socks5h://", "socks5h://proxy-account:proxy-secret@", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, err := proxyDialer.NewTransport(proxyURL, proxyDialer.Timeouts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	recorder, err := cassette.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording := &http.Client{Transport: recorder.Wrap(buff.WrapTransport(proxied))}
+	// The second request reuses the connection
+	get(t, recording, buff.URL()+mockBuff.PathGoodsInfo+"?game=csgo&goods_id=1001")
+	get(t, recording, buff.URL()+mockBuff.PathGoodsInfo+"?game=csgo&goods_id=1002")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("recorded %d cassettes, want 2", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"proxy-account", "proxy-secret"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("cassette %s contains %q", file, secret)
+			}
+		}
+		if !strings.Contains(string(data), `"proxy": "`+buff.SOCKSProxyURL()+`"`) {
+			t.Errorf("cassette %s doesn't name the SOCKS5 proxy", file)
+		}
+	}
+}
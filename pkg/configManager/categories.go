@@ -0,0 +1,134 @@
+package configManager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxCategories = 6
+
+// Category priorities define the order categories are parsed in, so the budget set by max goes to the most wanted ones
+const (
+	// PriorityDefault keeps the order buff163 returns the categories in
+	PriorityDefault = "default"
+	// PriorityLowestFirst parses ranges with the lowest lower bound first, e.g. the lowest floats
+	PriorityLowestFirst = "lowest_first"
+	// PriorityHighestFirst parses ranges with the highest lower bound first
+	PriorityHighestFirst = "highest_first"
+)
+
+// CategoriesConfig defines which categories of an item are parsed in cookie mode, per category kind
+type CategoriesConfig struct {
+	Float CategoryKindConfig `yaml:"float"`
+	Fade  CategoryKindConfig `yaml:"fade"`
+	// Style covers asset tag and paintseed filter categories
+	Style CategoryKindConfig `yaml:"style"`
+}
+
+// CategoryKindConfig selects categories of one kind. Float and fade categories are matched by range like "0.00-0.01",
+// style categories by name.
+type CategoryKindConfig struct {
+	// Max is the maximum number of categories of the kind parsed per item, 0 disables the kind. 6 if not set
+	Max *int `yaml:"max"`
+	// Include lists the only categories that may be parsed, all if empty
+	Include []string `yaml:"include"`
+	// Exclude lists categories that are never parsed
+	Exclude []string `yaml:"exclude"`
+	// Priority is one of default, lowest_first and highest_first
+	Priority string `yaml:"priority"`
+}
+
+// Limit returns the maximum number of categories of the kind parsed per item
+func (c CategoryKindConfig) Limit() int {
+	if c.Max == nil {
+		return defaultMaxCategories
+	}
+	return *c.Max
+}
+
+// merge returns c with the rules set in override replaced
+func (c CategoryKindConfig) merge(override CategoryKindConfig) CategoryKindConfig {
+	if override.Max != nil {
+		c.Max = override.Max
+	}
+	if override.Include != nil {
+		c.Include = override.Include
+	}
+	if override.Exclude != nil {
+		c.Exclude = override.Exclude
+	}
+	if override.Priority != "" {
+		c.Priority = override.Priority
+	}
+	return c
+}
+
+// CategoriesFor returns the category rules for the goods ID, with its override applied if there is one
+func (c *CookieParsingConfig) CategoriesFor(goodsID string) CategoriesConfig {
+	override, ok := c.CategoryOverrides[goodsID]
+	if !ok {
+		return c.Categories
+	}
+	return CategoriesConfig{
+		Float: c.Categories.Float.merge(override.Float),
+		Fade:  c.Categories.Fade.merge(override.Fade),
+		Style: c.Categories.Style.merge(override.Style),
+	}
+}
+
+func (c *CategoriesConfig) validate() error {
+	if err := c.Float.validate(true); err != nil {
+		return fmt.Errorf("float: %v", err)
+	}
+	if err := c.Fade.validate(true); err != nil {
+		return fmt.Errorf("fade: %v", err)
+	}
+	if err := c.Style.validate(false); err != nil {
+		return fmt.Errorf("style: %v", err)
+	}
+	return nil
+}
+
+func (c *CategoryKindConfig) validate(ranged bool) error {
+	if c.Limit() < 0 {
+		return fmt.Errorf("max must not be negative")
+	}
+	switch c.Priority {
+	case "", PriorityDefault, PriorityLowestFirst, PriorityHighestFirst:
+	default:
+		return fmt.Errorf("unknown priority %q, expected %s, %s or %s", c.Priority, PriorityDefault, PriorityLowestFirst, PriorityHighestFirst)
+	}
+
+	for _, entry := range append(append([]string(nil), c.Include...), c.Exclude...) {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("include and exclude entries must not be empty")
+		}
+		if ranged {
+			if _, _, err := ParseRange(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRange parses a range like "0.00-0.01" into its bounds
+func ParseRange(entry string) (float64, float64, error) {
+	minStr, maxStr, found := strings.Cut(entry, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("range %q must look like min-max", entry)
+	}
+	min, err := strconv.ParseFloat(strings.TrimSpace(minStr), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid lower bound of range %q: %v", entry, err)
+	}
+	max, err := strconv.ParseFloat(strings.TrimSpace(maxStr), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid upper bound of range %q: %v", entry, err)
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("lower bound of range %q is greater than upper bound", entry)
+	}
+	return min, max, nil
+}
@@ -1,13 +1,208 @@
 package configManager
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Endpoint names of the backend API. They are used as keys of the
+// backend.endpoints map in config.yaml to override the default paths.
+const (
+	EndpointSignIn             = "signIn"
+	EndpointReserveAccount     = "reserveAccount"
+	EndpointReleaseAccount     = "releaseAccount"
+	EndpointResetAccounts      = "resetAccounts"
+	EndpointCookieParsingItems = "cookieParsingItems"
+	EndpointMissingBuffIDs     = "missingBuffIDs"
+	EndpointParsingProxies     = "parsingProxies"
+	EndpointItems              = "items"
+	EndpointSales              = "sales"
+	EndpointHistoricalPrices   = "historicalPrices"
+	EndpointListings           = "listings"
+)
+
+var defaultEndpoints = map[string]string{
+	EndpointSignIn:             "/auth/signin",
+	EndpointReserveAccount:     "/reserveAccount",
+	EndpointReleaseAccount:     "/releaseaccount",
+	EndpointResetAccounts:      "/resetaccounts",
+	EndpointCookieParsingItems: "/cookieparsingitems",
+	EndpointMissingBuffIDs:     "/missingbuffids",
+	EndpointParsingProxies:     "/fetchParsingProxies",
+	EndpointItems:              "/items",
+	EndpointSales:              "/sales",
+	EndpointHistoricalPrices:   "/historicalprices",
+	EndpointListings:           "/listings",
+}
+
+// Endpoint names of buff163. They are used as keys of the buff.paths map in config.yaml
+// to override the default path templates.
+const (
+	BuffGoodsPage    = "goodsPage"
+	BuffGoodsInfo    = "goodsInfo"
+	BuffSellOrder    = "sellOrder"
+	BuffBuyOrder     = "buyOrder"
+	BuffPriceHistory = "priceHistory"
+	BuffBillOrder    = "billOrder"
+)
+
+// defaultBuffPaths are path templates of buff163 endpoints. {goods_id} and {game} are replaced
+// with the escaped goods ID and game of the item.
+var defaultBuffPaths = map[string]string{
+	BuffGoodsPage:    "/goods/{goods_id}",
+	BuffGoodsInfo:    "/api/market/goods/info",
+	BuffSellOrder:    "/api/market/goods/sell_order",
+	BuffBuyOrder:     "/api/market/goods/buy_order",
+	BuffPriceHistory: "/api/market/goods/price_history/buff",
+	BuffBillOrder:    "/api/market/goods/bill_order",
+}
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	defaultBuffBaseURL     = "https://buff.163.com"
+	defaultMaxWorkers      = 10
+	defaultProxyDelay      = 3 * time.Second
+
+	defaultDialTimeout           = 10 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 20 * time.Second
+	defaultRequestTimeout        = time.Minute
+
+	defaultProxyFailureThreshold = 3
+	defaultProxyQuarantineBase   = 30 * time.Second
+	defaultProxyQuarantineMax    = 30 * time.Minute
+
+	defaultPriceHistoryCurrency  = "USD"
+	defaultPriceHistoryDays      = 7
+	defaultPriceHistoryPriceType = 2
+
+	defaultCanonicalCurrency    = "USD"
+	defaultSourceCurrency       = "CNY"
+	defaultRatesRefreshInterval = time.Hour
+
+	defaultQuarantineDir       = "quarantine"
+	defaultDriftWarnInterval   = 10 * time.Minute
+	defaultMaxQuarantinedFiles = 100
 )
 
 type Config struct {
-	Mode string `yaml:"mode"`
-	//BackendAPIKeyEnv string `yaml:"backend_apikey_env"`
+	Mode    string        `yaml:"mode"`
+	Backend BackendConfig `yaml:"backend"`
+	Buff    BuffConfig    `yaml:"buff"`
+	// BackendAPIKeyEnv is the name of the environment variable holding the backend API key
+	BackendAPIKeyEnv string `yaml:"backend_apikey_env"`
+	// ShutdownTimeout is how long in-flight workers may run after SIGINT/SIGTERM before they are aborted
+	ShutdownTimeout  time.Duration          `yaml:"shutdown_timeout"`
+	CookieParsing    CookieParsingConfig    `yaml:"cookie_parsing"`
+	NonCookieParsing NonCookieParsingConfig `yaml:"non_cookie_parsing"`
+	HTTP             HTTPConfig             `yaml:"http"`
+	SchemaDrift      SchemaDriftConfig      `yaml:"schema_drift"`
+	Currency         CurrencyConfig         `yaml:"currency"`
+}
+
+// CurrencyConfig sets how prices are normalized to a single currency
+type CurrencyConfig struct {
+	// Canonical is the currency every price is normalized to, USD by default
+	Canonical string `yaml:"canonical"`
+	// Source is the currency of buff163 prices in goods/info, sell_order, buy_order and bill_order, CNY by default
+	Source string `yaml:"source"`
+	// Rates are prices of a unit of each currency in the canonical currency
+	Rates map[string]float64 `yaml:"rates"`
+	// RatesFile is an optional JSON file like {"rates": {"CNY": 0.14}}, its rates override the static ones
+	RatesFile string `yaml:"rates_file"`
+	// RefreshInterval is how often the rates file is reloaded
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// SchemaDriftConfig tunes handling of buff163 responses that don't match the expected schema
+type SchemaDriftConfig struct {
+	// QuarantineDir is where bodies of such responses are saved with their metadata, by endpoint
+	QuarantineDir string `yaml:"quarantine_dir"`
+	// WarnInterval is the minimal interval between two drift warnings for the same endpoint
+	WarnInterval time.Duration `yaml:"warn_interval"`
+	// MaxQuarantined caps the number of bodies saved per endpoint while the parser runs
+	MaxQuarantined int `yaml:"max_quarantined"`
+}
+
+// HTTPConfig holds timeouts of requests to buff163 made through proxies
+type HTTPConfig struct {
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	// RequestTimeout bounds the whole request, including reading the body
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+}
+
+type CookieParsingConfig struct {
+	// MaxWorkers is the maximum number of accounts parsing at the same time
+	MaxWorkers int              `yaml:"max_workers"`
+	Categories CategoriesConfig `yaml:"categories"`
+	// CategoryOverrides replaces category rules for specific goods IDs. Only the rules set in an override are replaced.
+	CategoryOverrides map[string]CategoriesConfig `yaml:"category_overrides"`
+	Pagination        PaginationConfig            `yaml:"pagination"`
+	// BuyOrders enables fetching of the buy order book of every item
+	BuyOrders    bool               `yaml:"buy_orders"`
+	PriceHistory PriceHistoryConfig `yaml:"price_history"`
+}
+
+// PriceHistoryConfig sets the price_history requests made for accounts linked to Steam
+type PriceHistoryConfig struct {
+	// Currency of the prices, e.g. USD or CNY
+	Currency string `yaml:"currency"`
+	// Days are the windows requested for every item, each one takes a request
+	Days []int `yaml:"days"`
+	// PriceType is the buff_price_type parameter, 2 by default
+	PriceType int `yaml:"price_type"`
+}
+
+// PaginationConfig limits fetching of sell_order pages for each category
+type PaginationConfig struct {
+	// MaxPages is the maximum number of pages fetched per category, 1 by default
+	MaxPages int `yaml:"max_pages"`
+	// MaxListings stops fetching once this many listings are collected, 0 means no limit
+	MaxListings int `yaml:"max_listings"`
+	// PriceCeilingPercent stops fetching at the first listing more expensive than the cheapest one
+	// by this percent, 0 means no ceiling
+	PriceCeilingPercent float64 `yaml:"price_ceiling_percent"`
+}
+
+type NonCookieParsingConfig struct {
+	// Workers is the total number of workers fetching items at once. Every worker takes any available proxy
+	// from the pool for each request, so it isn't bound to a proxy. 0 means one worker per proxy
+	Workers int `yaml:"workers"`
+	// ProxyDelay is the minimal delay between two requests through the same proxy
+	ProxyDelay time.Duration `yaml:"proxy_delay"`
+	// ProxyFailureThreshold is the number of consecutive failed requests that puts a proxy into quarantine
+	ProxyFailureThreshold int `yaml:"proxy_failure_threshold"`
+	// ProxyQuarantineBase is the first quarantine cool-down, it doubles with every quarantine in a row
+	ProxyQuarantineBase time.Duration `yaml:"proxy_quarantine_base"`
+	// ProxyQuarantineMax caps the quarantine cool-down
+	ProxyQuarantineMax time.Duration `yaml:"proxy_quarantine_max"`
+	// BuyOrders enables fetching of the buy order book of every item, it takes one more request per item
+	BuyOrders bool `yaml:"buy_orders"`
+}
+
+type BackendConfig struct {
+	// BaseURL is the scheme and host (optionally with a path prefix) of the backend, e.g. http://localhost
+	BaseURL string `yaml:"base_url"`
+	// Endpoints overrides the default path of an endpoint, keyed by endpoint name
+	Endpoints map[string]string `yaml:"endpoints"`
+	// TokenRefreshBefore is how long before the JWT expiry a new token is requested, 1m by default
+	TokenRefreshBefore time.Duration `yaml:"token_refresh_before"`
+
+	baseURL *url.URL
+}
+
+// BuffConfig sets where buff163 requests are sent, e.g. to a mirror or a local fake
+type BuffConfig struct {
+	// BaseURL is the scheme and host (optionally with a path prefix) of buff163, https://buff.163.com by default
+	BaseURL string `yaml:"base_url"`
+	// Paths overrides the default path template of an endpoint, keyed by endpoint name
+	Paths map[string]string `yaml:"paths"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -21,5 +216,301 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.Backend.validate(); err != nil {
+		return nil, fmt.Errorf("invalid backend config: %v", err)
+	}
+	if err := config.Buff.validate(); err != nil {
+		return nil, fmt.Errorf("invalid buff config: %v", err)
+	}
+	if config.BackendAPIKeyEnv == "" {
+		return nil, fmt.Errorf("backend_apikey_env is required")
+	}
+	if config.ShutdownTimeout < 0 {
+		return nil, fmt.Errorf("shutdown_timeout must not be negative")
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if err := config.CookieParsing.validate(); err != nil {
+		return nil, fmt.Errorf("invalid cookie_parsing config: %v", err)
+	}
+	if err := config.NonCookieParsing.validate(); err != nil {
+		return nil, fmt.Errorf("invalid non_cookie_parsing config: %v", err)
+	}
+	if err := config.HTTP.validate(); err != nil {
+		return nil, fmt.Errorf("invalid http config: %v", err)
+	}
+	if err := config.SchemaDrift.validate(); err != nil {
+		return nil, fmt.Errorf("invalid schema_drift config: %v", err)
+	}
+	if err := config.Currency.validate(); err != nil {
+		return nil, fmt.Errorf("invalid currency config: %v", err)
+	}
+
 	return &config, nil
 }
+
+func (b *BackendConfig) validate() error {
+	if b.BaseURL == "" {
+		return fmt.Errorf("base_url is required")
+	}
+	parsed, err := url.Parse(b.BaseURL)
+	if err != nil {
+		return fmt.Errorf("error parsing base_url: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("base_url must use http or https scheme, got %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("base_url %q has no host", b.BaseURL)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("base_url %q must not contain a query or fragment", b.BaseURL)
+	}
+	if b.TokenRefreshBefore < 0 {
+		return fmt.Errorf("token_refresh_before must not be negative")
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	parsed.RawPath = ""
+
+	for name, path := range b.Endpoints {
+		if _, known := defaultEndpoints[name]; !known {
+			return fmt.Errorf("unknown endpoint %q", name)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("path of endpoint %q must start with '/', got %q", name, path)
+		}
+		if strings.ContainsAny(path, "?#") {
+			return fmt.Errorf("path of endpoint %q must not contain a query or fragment", name)
+		}
+	}
+
+	b.baseURL = parsed
+	return nil
+}
+
+func (b *BuffConfig) validate() error {
+	if b.BaseURL == "" {
+		b.BaseURL = defaultBuffBaseURL
+	}
+	parsed, err := url.Parse(b.BaseURL)
+	if err != nil {
+		return fmt.Errorf("error parsing base_url: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("base_url must use http or https scheme, got %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("base_url %q has no host", b.BaseURL)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("base_url %q must not contain a query or fragment", b.BaseURL)
+	}
+
+	for name, path := range b.Paths {
+		if _, known := defaultBuffPaths[name]; !known {
+			return fmt.Errorf("unknown endpoint %q", name)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("path of endpoint %q must start with '/', got %q", name, path)
+		}
+		if strings.ContainsAny(path, "?#") {
+			return fmt.Errorf("path of endpoint %q must not contain a query or fragment", name)
+		}
+	}
+	return nil
+}
+
+func (c *CookieParsingConfig) validate() error {
+	if c.MaxWorkers < 0 {
+		return fmt.Errorf("max_workers must not be negative")
+	}
+	if c.MaxWorkers == 0 {
+		c.MaxWorkers = defaultMaxWorkers
+	}
+	if err := c.Categories.validate(); err != nil {
+		return fmt.Errorf("categories: %v", err)
+	}
+	if c.Pagination.MaxPages < 0 || c.Pagination.MaxListings < 0 || c.Pagination.PriceCeilingPercent < 0 {
+		return fmt.Errorf("pagination settings must not be negative")
+	}
+	if c.Pagination.MaxPages == 0 {
+		c.Pagination.MaxPages = 1
+	}
+	if err := c.PriceHistory.validate(); err != nil {
+		return fmt.Errorf("price_history: %v", err)
+	}
+	for goodsID, override := range c.CategoryOverrides {
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("category_overrides.%s: %v", goodsID, err)
+		}
+	}
+	return nil
+}
+
+func (c *PriceHistoryConfig) validate() error {
+	if c.Currency == "" {
+		c.Currency = defaultPriceHistoryCurrency
+	}
+	if err := validateCurrencyCode("currency", c.Currency); err != nil {
+		return err
+	}
+	if len(c.Days) == 0 {
+		c.Days = []int{defaultPriceHistoryDays}
+	}
+	for _, days := range c.Days {
+		if days <= 0 {
+			return fmt.Errorf("days must be positive, got %d", days)
+		}
+	}
+	if c.PriceType < 0 {
+		return fmt.Errorf("price_type must not be negative")
+	}
+	if c.PriceType == 0 {
+		c.PriceType = defaultPriceHistoryPriceType
+	}
+	return nil
+}
+
+func (c *NonCookieParsingConfig) validate() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
+	}
+	if c.ProxyDelay < 0 {
+		return fmt.Errorf("proxy_delay must not be negative")
+	}
+	if c.ProxyDelay == 0 {
+		c.ProxyDelay = defaultProxyDelay
+	}
+	if c.ProxyFailureThreshold < 0 || c.ProxyQuarantineBase < 0 || c.ProxyQuarantineMax < 0 {
+		return fmt.Errorf("proxy quarantine settings must not be negative")
+	}
+	if c.ProxyFailureThreshold == 0 {
+		c.ProxyFailureThreshold = defaultProxyFailureThreshold
+	}
+	if c.ProxyQuarantineBase == 0 {
+		c.ProxyQuarantineBase = defaultProxyQuarantineBase
+	}
+	if c.ProxyQuarantineMax == 0 {
+		c.ProxyQuarantineMax = defaultProxyQuarantineMax
+	}
+	if c.ProxyQuarantineMax < c.ProxyQuarantineBase {
+		return fmt.Errorf("proxy_quarantine_max must not be less than proxy_quarantine_base")
+	}
+	return nil
+}
+
+func (c *HTTPConfig) validate() error {
+	timeouts := []struct {
+		value        *time.Duration
+		name         string
+		defaultValue time.Duration
+	}{
+		{&c.DialTimeout, "dial_timeout", defaultDialTimeout},
+		{&c.TLSHandshakeTimeout, "tls_handshake_timeout", defaultTLSHandshakeTimeout},
+		{&c.ResponseHeaderTimeout, "response_header_timeout", defaultResponseHeaderTimeout},
+		{&c.RequestTimeout, "request_timeout", defaultRequestTimeout},
+	}
+	for _, timeout := range timeouts {
+		if *timeout.value < 0 {
+			return fmt.Errorf("%s must not be negative", timeout.name)
+		}
+		if *timeout.value == 0 {
+			*timeout.value = timeout.defaultValue
+		}
+	}
+	return nil
+}
+
+func validateCurrencyCode(name, code string) error {
+	if len(code) != 3 {
+		return fmt.Errorf("%s must be a currency code like USD, got %q", name, code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return fmt.Errorf("%s must be a currency code like USD, got %q", name, code)
+		}
+	}
+	return nil
+}
+
+func (c *CurrencyConfig) validate() error {
+	if c.Canonical == "" {
+		c.Canonical = defaultCanonicalCurrency
+	}
+	if c.Source == "" {
+		c.Source = defaultSourceCurrency
+	}
+	if err := validateCurrencyCode("canonical", c.Canonical); err != nil {
+		return err
+	}
+	if err := validateCurrencyCode("source", c.Source); err != nil {
+		return err
+	}
+	for currency, rate := range c.Rates {
+		if err := validateCurrencyCode("rates key", currency); err != nil {
+			return err
+		}
+		if rate <= 0 {
+			return fmt.Errorf("rate of %s must be positive", currency)
+		}
+	}
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval must not be negative")
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = defaultRatesRefreshInterval
+	}
+	return nil
+}
+
+func (c *SchemaDriftConfig) validate() error {
+	if c.WarnInterval < 0 || c.MaxQuarantined < 0 {
+		return fmt.Errorf("warn_interval and max_quarantined must not be negative")
+	}
+	if c.QuarantineDir == "" {
+		c.QuarantineDir = defaultQuarantineDir
+	}
+	if c.WarnInterval == 0 {
+		c.WarnInterval = defaultDriftWarnInterval
+	}
+	if c.MaxQuarantined == 0 {
+		c.MaxQuarantined = defaultMaxQuarantinedFiles
+	}
+	return nil
+}
+
+// URL builds the full URL of the named endpoint. Extra segments are escaped and appended to the path,
+// so URL(EndpointItems, goodsID) gives e.g. http://localhost/items/35213
+func (b *BackendConfig) URL(endpoint string, segments ...string) string {
+	path, ok := b.Endpoints[endpoint]
+	if !ok {
+		path = defaultEndpoints[endpoint]
+	}
+	for _, segment := range segments {
+		path = strings.TrimSuffix(path, "/") + "/" + url.PathEscape(segment)
+	}
+
+	base := b.baseURL
+	if base == nil {
+		// Config wasn't loaded with LoadConfig, fall back to the raw value
+		base, _ = url.Parse(strings.TrimSuffix(b.BaseURL, "/"))
+		if base == nil {
+			base = &url.URL{}
+		}
+	}
+	return base.String() + path
+}
+
+// Path returns the path template of the named buff163 endpoint, e.g. /goods/{goods_id} for BuffGoodsPage
+func (b *BuffConfig) Path(endpoint string) string {
+	if path, ok := b.Paths[endpoint]; ok {
+		return path
+	}
+	return defaultBuffPaths[endpoint]
+}
+
+// DefaultBuffPath returns the path template buff163 itself uses for the named endpoint
+func DefaultBuffPath(endpoint string) string {
+	return defaultBuffPaths[endpoint]
+}
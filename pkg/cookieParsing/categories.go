@@ -0,0 +1,119 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/model"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// categoryLabel names the category in logs: style categories have a name, float and fade ones a range
+func categoryLabel(category *model.Category) string {
+	if category.Name != nil {
+		return *category.Name
+	}
+	return strings.Join(category.Range, "-")
+}
+
+// categoryMatches reports whether the category is the one named by a config entry.
+// Ranged categories match entries like "0.00-0.01" by value, the rest match by name.
+func categoryMatches(category *model.Category, entry string) bool {
+	if len(category.Range) == 2 {
+		min, max, err := configManager.ParseRange(entry)
+		if err != nil {
+			return false
+		}
+		return categoryLowerBound(category) == min && parseBound(category.Range[1]) == max
+	}
+	return category.Name != nil && strings.EqualFold(strings.TrimSpace(*category.Name), strings.TrimSpace(entry))
+}
+
+func matchesAny(category *model.Category, entries []string) bool {
+	for _, entry := range entries {
+		if categoryMatches(category, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryLowerBound returns the lower bound of a ranged category, NaN for categories without range
+func categoryLowerBound(category *model.Category) float64 {
+	if len(category.Range) != 2 {
+		return math.NaN()
+	}
+	return parseBound(category.Range[0])
+}
+
+func parseBound(bound string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return value
+}
+
+// selectCategories applies the rules to the categories and returns indexes of the ones to parse, in parsing order.
+// Categories without range keep their order under lowest_first and highest_first and go after ranged ones.
+// Categories of kinds this version doesn't know are skipped and posted back unchanged.
+func selectCategories(categories []model.Category, rules configManager.CategoryKindConfig) []int {
+	var selected []int
+	for idx := range categories {
+		category := &categories[idx]
+		if !category.Kind.Known() {
+			continue
+		}
+		if len(rules.Include) > 0 && !matchesAny(category, rules.Include) {
+			continue
+		}
+		if matchesAny(category, rules.Exclude) {
+			continue
+		}
+		selected = append(selected, idx)
+	}
+
+	if rules.Priority == configManager.PriorityLowestFirst || rules.Priority == configManager.PriorityHighestFirst {
+		sort.SliceStable(selected, func(i, j int) bool {
+			a, b := categoryLowerBound(&categories[selected[i]]), categoryLowerBound(&categories[selected[j]])
+			if math.IsNaN(a) || math.IsNaN(b) {
+				return !math.IsNaN(a) && math.IsNaN(b)
+			}
+			if rules.Priority == configManager.PriorityLowestFirst {
+				return a < b
+			}
+			return a > b
+		})
+	}
+
+	if limit := rules.Limit(); len(selected) > limit {
+		selected = selected[:limit]
+	}
+	return selected
+}
+
+// parseCategories fetches sell orders of the categories selected by the rules and fills their Price
+// and ListingsPrices in place. It returns false if the session must stop.
+func (s *accountSession) parseCategories(categories []model.Category, rules configManager.CategoryKindConfig) bool {
+	for _, idx := range selectCategories(categories, rules) {
+		category := &categories[idx]
+		listingsPrices, ok := s.fetchSellOrders(category)
+		if !ok {
+			return false
+		}
+
+		// Update the category price if there are items in the response
+		if len(listingsPrices) > 0 {
+			category.ListingsPrices = listingsPrices
+			price := listingsPrices[0]
+			category.Price = &price
+		}
+
+		// Delay between requests
+		if !s.sleep() {
+			return false
+		}
+	}
+	return true
+}
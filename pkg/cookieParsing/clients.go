@@ -0,0 +1,119 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/proxyDialer"
+	"buff163Parser/pkg/upstream"
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+)
+
+type clientKey struct {
+	accountID int
+	proxy     string
+}
+
+type accountClient struct {
+	client *http.Client
+	jar    *cookiejar.Jar
+}
+
+// clientCache keeps one HTTP client per account and proxy, so all requests of an account session
+// reuse the same keep-alive connections through the proxy instead of a new handshake each time.
+// Each client has a cookie jar seeded with the account cookie, which picks up cookies rotated by buff163.
+type clientCache struct {
+	timeouts proxyDialer.Timeouts
+	buff     *upstream.Buff
+
+	mu      sync.Mutex
+	clients map[clientKey]*accountClient
+}
+
+func newClientCache(timeouts proxyDialer.Timeouts, buff *upstream.Buff) *clientCache {
+	return &clientCache{timeouts: timeouts, buff: buff, clients: make(map[clientKey]*accountClient)}
+}
+
+// get returns the client of the account, creating it on first use. It fails if the account proxy is invalid.
+func (c *clientCache) get(account *backend.Account) (*http.Client, error) {
+	key := clientKey{accountID: account.ID, proxy: account.Proxy}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.clients[key]; ok {
+		return cached.client, nil
+	}
+
+	proxyURL, err := proxyDialer.Parse(account.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	client, err := proxyDialer.NewClient(proxyURL, c.timeouts)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, fmt.Errorf("error creating cookie jar: %v", err)
+	}
+	jar.SetCookies(c.buff.CookieURL(), parseCookieHeader(account.Cookie))
+	client.Jar = jar
+	client.Transport = c.buff.RoundTripper(client.Transport)
+
+	c.clients[key] = &accountClient{client: client, jar: jar}
+	return client, nil
+}
+
+// teardown closes connections of the account client and forgets it, it's called when the account is released.
+// It returns the cookie string of the session and whether buff163 changed any cookie of the account.
+func (c *clientCache) teardown(account *backend.Account) (string, bool) {
+	key := clientKey{accountID: account.ID, proxy: account.Proxy}
+
+	c.mu.Lock()
+	cached, ok := c.clients[key]
+	delete(c.clients, key)
+	c.mu.Unlock()
+
+	if !ok {
+		return account.Cookie, false
+	}
+	cached.client.CloseIdleConnections()
+
+	cookies := cached.jar.Cookies(c.buff.CookieURL())
+	return formatCookieHeader(cookies), !sameCookies(parseCookieHeader(account.Cookie), cookies)
+}
+
+// parseCookieHeader parses a Cookie header value like "session=abc; csrf_token=def"
+func parseCookieHeader(cookieStr string) []*http.Cookie {
+	request := &http.Request{Header: http.Header{"Cookie": {cookieStr}}}
+	return request.Cookies()
+}
+
+// sameCookies compares cookies by names and values, ignoring the order
+func sameCookies(a, b []*http.Cookie) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	values := make(map[string]string, len(a))
+	for _, cookie := range a {
+		values[cookie.Name] = cookie.Value
+	}
+	for _, cookie := range b {
+		if value, ok := values[cookie.Name]; !ok || value != cookie.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func formatCookieHeader(cookies []*http.Cookie) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		pairs = append(pairs, cookie.Name+"="+cookie.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
@@ -0,0 +1,32 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/prices"
+)
+
+func normalizeListings(listings []model.ProcessedListing, converter *prices.Converter) {
+	for i := range listings {
+		listings[i].PriceConverted = converter.ConvertSource(listings[i].Price)
+	}
+}
+
+// normalizePriceHistory converts the price of every point, the second value, from the history currency
+func normalizePriceHistory(history *model.ResultData, converter *prices.Converter) {
+	history.NormalizedCurrency = ""
+	history.NormalizedPriceHistory = nil
+	normalized := make([][]float64, 0, len(history.PriceHistory))
+	for _, point := range history.PriceHistory {
+		point = append([]float64(nil), point...)
+		if len(point) > 1 {
+			price, ok := converter.ConvertFloat(point[1], history.Currency)
+			if !ok {
+				return
+			}
+			point[1] = price
+		}
+		normalized = append(normalized, point)
+	}
+	history.NormalizedCurrency = converter.Canonical()
+	history.NormalizedPriceHistory = normalized
+}
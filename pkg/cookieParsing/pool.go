@@ -0,0 +1,82 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/shutdown"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// workerPool limits the number of accounts parsing at the same time.
+// A slot is taken before an account is reserved, so reserved accounts never wait for a worker.
+type workerPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newWorkerPool(maxWorkers int) *workerPool {
+	return &workerPool{slots: make(chan struct{}, maxWorkers)}
+}
+
+// acquire blocks until a worker slot is free. It reports false if ctx was done first.
+func (p *workerPool) acquire(ctx context.Context) bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees a slot taken with acquire that wasn't handed to run
+func (p *workerPool) release() {
+	<-p.slots
+}
+
+// run starts f in the slot taken with acquire and frees the slot when f returns
+func (p *workerPool) run(f func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.release()
+		f()
+	}()
+}
+
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
+
+// feedGoodsIDs pushes shuffled work items into queue until ctx is done, then closes it.
+// When all items are queued it waits for 10 minutes and fetches them from the backend again.
+func feedGoodsIDs(ctx context.Context, backendClient *backend.Client, buffIDs []backend.WorkItem, queue chan<- backend.WorkItem) {
+	defer close(queue)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		r.Shuffle(len(buffIDs), func(i, j int) {
+			buffIDs[i], buffIDs[j] = buffIDs[j], buffIDs[i]
+		})
+		for _, id := range buffIDs {
+			select {
+			case queue <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		cookieParsingLogger.Info("No more buff IDs to queue. Waiting for 10 minutes...")
+		if !shutdown.Sleep(ctx, 10*time.Minute) {
+			return
+		}
+		var err error
+		buffIDs, err = backendClient.CookieParsingItems(ctx)
+		if err != nil {
+			cookieParsingLogger.Error("Error fetching missing buff IDs after waiting:", err)
+			continue
+		}
+		cookieParsingLogger.Infof("Total missing buff IDs fetched: %d", len(buffIDs))
+	}
+}
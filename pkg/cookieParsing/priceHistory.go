@@ -0,0 +1,34 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/schemaDrift"
+	"encoding/json"
+)
+
+// fetchPriceHistory gets the price history of the item for a window of days in the configured currency
+// and price type. It returns false if the session must stop.
+func (s *accountSession) fetchPriceHistory(item *model.ProcessedItem, days int) (*model.ResultData, bool) {
+	settings := s.config.PriceHistory
+	responseData, ok := s.get(s.buff.PriceHistory(item.Game, item.GoodsID, settings.Currency, days, settings.PriceType), "price history")
+	if !ok || !s.checkSchema(schemaDrift.EndpointPriceHistory, priceHistorySchema, responseData) {
+		return nil, false
+	}
+
+	var priceHistoryResponse PriceHistoryResponse
+	if err := json.Unmarshal(responseData, &priceHistoryResponse); err != nil {
+		s.logger.WithError(err).Errorf("Error unmarshalling price history for %d days", days)
+		return nil, false
+	}
+
+	data := priceHistoryResponse.Data
+	return &model.ResultData{
+		GoodsID:            item.GoodsID,
+		Currency:           data.Currency,
+		CurrencySymbol:     data.CurrencySymbol,
+		Days:               days,
+		PriceType:          data.PriceType,
+		SteamPriceCurrency: data.SteamPriceCurrency,
+		PriceHistory:       data.PriceHistory,
+	}, true
+}
@@ -0,0 +1,72 @@
+package cookieParsing
+
+import "buff163Parser/pkg/schemaDrift"
+
+// Expected shapes of buff163 responses parsed in cookie mode. Only the fields the parser reads are described.
+
+var stickerSchema = schemaDrift.Object(schemaDrift.Fields{
+	"category":   schemaDrift.String(),
+	"img_url":    schemaDrift.String(),
+	"name":       schemaDrift.String(),
+	"slot":       schemaDrift.Number(),
+	"sticker_id": schemaDrift.Number(),
+	"wear":       schemaDrift.Number(),
+})
+
+var sellOrdersSchema = schemaDrift.Object(schemaDrift.Fields{
+	"code": schemaDrift.Required(schemaDrift.String()),
+	"msg":  schemaDrift.Any(),
+	"data": schemaDrift.Required(schemaDrift.Object(schemaDrift.Fields{
+		"items": schemaDrift.Required(schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+			"id":       schemaDrift.String(),
+			"goods_id": schemaDrift.Number(),
+			"price":    schemaDrift.Required(schemaDrift.String()),
+			"user_id":  schemaDrift.String(),
+			"asset_info": schemaDrift.Object(schemaDrift.Fields{
+				"paintwear": schemaDrift.String(),
+				"info": schemaDrift.Object(schemaDrift.Fields{
+					"paintindex": schemaDrift.Number(),
+					"paintseed":  schemaDrift.Number(),
+					"stickers":   schemaDrift.Array(stickerSchema),
+				}),
+			}),
+		}))),
+		"page_num":    schemaDrift.Number(),
+		"page_size":   schemaDrift.Number(),
+		"total_count": schemaDrift.Number(),
+		"total_page":  schemaDrift.Number(),
+	})),
+})
+
+var priceHistorySchema = schemaDrift.Object(schemaDrift.Fields{
+	"code": schemaDrift.Required(schemaDrift.String()),
+	"msg":  schemaDrift.Any(),
+	"data": schemaDrift.Required(schemaDrift.Object(schemaDrift.Fields{
+		"currency":             schemaDrift.String(),
+		"currency_symbol":      schemaDrift.String(),
+		"days":                 schemaDrift.Number(),
+		"price_history":        schemaDrift.Required(schemaDrift.Array(schemaDrift.Array(schemaDrift.Number()))),
+		"price_type":           schemaDrift.String(),
+		"steam_price_currency": schemaDrift.String(),
+	})),
+})
+
+var billOrderSchema = schemaDrift.Object(schemaDrift.Fields{
+	"code": schemaDrift.Required(schemaDrift.String()),
+	"msg":  schemaDrift.Any(),
+	"data": schemaDrift.Required(schemaDrift.Object(schemaDrift.Fields{
+		"items": schemaDrift.Required(schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+			"asset_info": schemaDrift.Object(schemaDrift.Fields{
+				"info": schemaDrift.Object(schemaDrift.Fields{
+					"stickers": schemaDrift.Array(stickerSchema),
+				}),
+				"goods_id":  schemaDrift.Number(),
+				"paintwear": schemaDrift.String(),
+				"id":        schemaDrift.String(),
+			}),
+			"price":         schemaDrift.Required(schemaDrift.String()),
+			"seller_id":     schemaDrift.String(),
+			"transact_time": schemaDrift.Number(),
+		}))),
+	})),
+})
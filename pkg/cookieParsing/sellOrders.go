@@ -0,0 +1,107 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/schemaDrift"
+	"buff163Parser/pkg/upstream"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// sellOrdersPageLink returns the sell_order API link of the category moved onto buff, with page_num set to page
+func sellOrdersPageLink(buff *upstream.Buff, apiLink string, page int) (string, error) {
+	apiLink, err := buff.Rebase(apiLink)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := url.Parse(apiLink)
+	if err != nil {
+		return "", fmt.Errorf("error parsing category API link: %v", err)
+	}
+	query := parsed.Query()
+	query.Set("page_num", strconv.Itoa(page))
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// fetchSellOrders collects listing prices of the category, cheapest first, and adds the listings to the session.
+// It fetches up to max_pages pages with the account delay between them and stops early once max_listings
+// are collected or listings get more expensive than the price ceiling. It returns false if the session must stop.
+func (s *accountSession) fetchSellOrders(category *model.Category) ([]string, bool) {
+	pagination := s.config.Pagination
+	label := categoryLabel(category)
+
+	var listingsPrices []string
+	var ceiling float64
+	for page := 1; page <= pagination.MaxPages; page++ {
+		if page > 1 && !s.sleep() {
+			return nil, false
+		}
+
+		pageLink, err := sellOrdersPageLink(s.buff, category.ApiLink, page)
+		if err != nil {
+			s.logger.WithError(err).Errorf("Error building link of page %d for category %s", page, label)
+			return nil, false
+		}
+		responseData, ok := s.get(pageLink, "category "+label)
+		if !ok || !s.checkSchema(schemaDrift.EndpointSellOrder, sellOrdersSchema, responseData) {
+			return nil, false
+		}
+
+		// Decode the response data
+		var result Buff163SellOrdersResponse
+		if err := json.Unmarshal(responseData, &result); err != nil {
+			s.logger.WithError(err).Errorf("Error decoding response data for category %s", label)
+			return nil, false
+		}
+
+		// Check for "Action Forbidden" in the response code
+		if result.Code == "Action Forbidden" {
+			s.logger.Errorf("Error with categories request, response data: %s", string(responseData))
+			s.isBanned = true
+			return nil, false
+		}
+		if result.Code != "OK" {
+			s.logger.Errorf("Error with categories request, response data: %s", string(responseData))
+			s.isBanned = true
+			return nil, false
+		}
+
+		for _, rangeItem := range result.Data.Items {
+			if pagination.PriceCeilingPercent > 0 {
+				price, err := strconv.ParseFloat(rangeItem.Price, 64)
+				if err != nil {
+					s.logger.WithError(err).Errorf("Error parsing listing price %q for category %s", rangeItem.Price, label)
+					return listingsPrices, true
+				}
+				if len(listingsPrices) == 0 {
+					ceiling = price * (1 + pagination.PriceCeilingPercent/100)
+				} else if price > ceiling {
+					return listingsPrices, true
+				}
+			}
+			listingsPrices = append(listingsPrices, rangeItem.Price)
+			s.addListing(model.ProcessedListing{
+				SellOrderID: rangeItem.ID,
+				GoodsID:     rangeItem.GoodsID,
+				Price:       rangeItem.Price,
+				Float:       rangeItem.AssetInfo.Paintwear,
+				PaintSeed:   rangeItem.AssetInfo.Info.PaintSeed,
+				PaintIndex:  rangeItem.AssetInfo.Info.PaintIndex,
+				Stickers:    rangeItem.AssetInfo.Info.Stickers,
+				SellerID:    rangeItem.UserID,
+				Category:    label,
+			})
+			if pagination.MaxListings > 0 && len(listingsPrices) >= pagination.MaxListings {
+				return listingsPrices, true
+			}
+		}
+
+		if len(result.Data.Items) == 0 || page >= result.Data.TotalPage {
+			break
+		}
+	}
+	return listingsPrices, true
+}
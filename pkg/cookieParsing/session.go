@@ -0,0 +1,110 @@
+package cookieParsing
+
+import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/buyOrders"
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/schemaDrift"
+	"buff163Parser/pkg/upstream"
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// accountSession holds the state of a single account while it parses an item.
+// Its counters are sent to the backend when the account is released.
+type accountSession struct {
+	ctx     context.Context
+	account *backend.Account
+	client  *http.Client
+	logger  *logrus.Entry
+	config  *configManager.CookieParsingConfig
+	drift   *schemaDrift.Detector
+	buff    *upstream.Buff
+	goodsID string
+
+	successfulReqs int
+	reqs429        int
+	isBanned       bool
+
+	// listings found in sell orders of all categories, once per sell order
+	listings       []model.ProcessedListing
+	seenSellOrders map[string]bool
+}
+
+// get makes a request to buff163 with the account and accounts its status code.
+// It returns the body and true on 200, otherwise the problem is logged and the session must stop.
+func (s *accountSession) get(apiLink, what string) ([]byte, bool) {
+	responseData, statusCode, err := makeRequestWithProxy(s.ctx, s.client, s.account.UserAgent, apiLink)
+	if err != nil {
+		s.logger.WithError(err).Errorf("Error making request with proxy for %s", what)
+		return nil, false
+	}
+
+	// Check for response status codes
+	switch {
+	case statusCode == http.StatusOK:
+		s.successfulReqs++
+		return responseData, true
+	case statusCode == http.StatusTooManyRequests:
+		s.reqs429++
+		s.logger.Errorf("Account got %d code with %s request", statusCode, what)
+	case statusCode == http.StatusForbidden: // Handling the 403 Forbidden status code
+		s.logger.Errorf("403 forbidden response, now this account banned")
+		s.isBanned = true
+	default:
+		s.logger.Errorf("Received unexpected status %d for %s request", statusCode, what)
+	}
+	return nil, false
+}
+
+// addListing collects the listing unless its sell order was already found in another category
+func (s *accountSession) addListing(listing model.ProcessedListing) {
+	if s.seenSellOrders == nil {
+		s.seenSellOrders = make(map[string]bool)
+	}
+	if listing.SellOrderID != "" && s.seenSellOrders[listing.SellOrderID] {
+		return
+	}
+	s.seenSellOrders[listing.SellOrderID] = true
+	s.listings = append(s.listings, listing)
+}
+
+// checkSchema checks the response against the schema of the endpoint, drifted responses are quarantined.
+// It returns false if the response must not be used, the problem is logged.
+func (s *accountSession) checkSchema(endpoint string, schema *schemaDrift.Schema, responseData []byte) bool {
+	metadata := schemaDrift.Metadata{GoodsID: s.goodsID, Account: s.account.ID, Proxy: s.account.Proxy}
+	if err := s.drift.Check(endpoint, schema, responseData, metadata); err != nil {
+		s.logger.WithError(err).Errorf("Unexpected %s response", endpoint)
+		return false
+	}
+	return true
+}
+
+// parseBuyOrders fetches the buy order book of the item. It returns false if the session must stop.
+func (s *accountSession) parseBuyOrders(item *model.ProcessedItem) bool {
+	responseData, ok := s.get(s.buff.BuyOrders(item.Game, item.GoodsID), "buy orders")
+	if !ok || !s.checkSchema(schemaDrift.EndpointBuyOrder, buyOrders.Schema, responseData) {
+		return false
+	}
+	book, err := buyOrders.Parse(responseData)
+	if err != nil {
+		var codeErr *buyOrders.CodeError
+		if errors.As(err, &codeErr) {
+			s.logger.Errorf("Error with buy orders request, response data: %s", string(responseData))
+			s.isBanned = true
+			return false
+		}
+		s.logger.WithError(err).Error("Error parsing buy orders")
+		return false
+	}
+	item.BuyOrderBook = book
+	return true
+}
+
+// sleep waits for the account inter item delay. It returns false if the session is aborted.
+func (s *accountSession) sleep() bool {
+	return interItemSleepDelay(s.ctx, s.account)
+}
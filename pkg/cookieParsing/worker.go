@@ -1,30 +1,58 @@
 package cookieParsing
 
 import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/configManager"
 	"buff163Parser/pkg/logger"
-	"bytes"
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/prices"
+	"buff163Parser/pkg/proxyDialer"
+	"buff163Parser/pkg/schemaDrift"
+	"buff163Parser/pkg/shutdown"
+	"buff163Parser/pkg/upstream"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"math/rand"
-	"net/http"
-	"sync"
 	"time"
 )
 
 var cookieParsingLogger = logger.Log.WithField("context", "cookieParsing")
 
-// TODO implement counting of goroutines(?)
-var wg sync.WaitGroup
+// releaseTimeout bounds releasing an account, it runs even when the worker was aborted
+const releaseTimeout = 30 * time.Second
+
+// StartCookieParsing reserves accounts and parses items with them until ctx is done.
+// At most config.CookieParsing.MaxWorkers accounts are held at once, a new one is reserved only when a worker is free.
+// After ctx is done no new accounts are reserved, in-flight workers get config.ShutdownTimeout to finish
+// and every reserved account is released before it returns. Every buff163 request is built and sent with buff.
+func StartCookieParsing(ctx context.Context, config *configManager.Config, backendClient *backend.Client, buff *upstream.Buff) error {
+	// workCtx outlives ctx by the shutdown timeout, so workers can finish their items
+	workCtx, abort := shutdown.AbortAfter(ctx, config.ShutdownTimeout)
+	defer abort()
+	pool := newWorkerPool(config.CookieParsing.MaxWorkers)
+	defer pool.wait()
+	converter, err := prices.NewConverter(config.Currency)
+	if err != nil {
+		cookieParsingLogger.Error("Error loading currency rates:", err)
+		return fmt.Errorf("error loading currency rates %s", err)
+	}
+	go converter.Refresh(ctx)
+	parser := &cookieParser{
+		backendClient: backendClient,
+		clients:       newClientCache(proxyDialer.TimeoutsFromConfig(config.HTTP), buff),
+		config:        &config.CookieParsing,
+		drift:         schemaDrift.NewDetector(config.SchemaDrift),
+		converter:     converter,
+		buff:          buff,
+	}
 
-func StartCookieParsing() error {
-	// Step 1: Authenticate and get the JWT token.
-	// jwtToken, err := Authenticate()
 	const N = 10 // Change this to your desired logging interval
 	parsedCount := 0
 	cookieParsingLogger.Info("Cookie parsing started!")
 
-	_, err := resetBuff163Accounts("jwtToken")
+	err = backendClient.ResetAccounts(ctx)
 	if err != nil {
 		cookieParsingLogger.Error("Error resetting buff163 accounts:", err)
 		return fmt.Errorf("error resetting buff163 accounts %s", err)
@@ -32,315 +60,238 @@ func StartCookieParsing() error {
 		cookieParsingLogger.Info("Accounts reset successfully")
 	}
 
-	buffIDs, err := fetchCookieParsingBuffIDs("jwtToken")
+	buffIDs, err := backendClient.CookieParsingItems(ctx)
 	if err != nil {
 		cookieParsingLogger.Error("Error fetching missing buff IDs:", err)
 		return fmt.Errorf("error fetching missing buff IDs %s", err)
 	}
-	//var buffIDs []string = []string{"35213"}
-	src := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(src)
-	r.Shuffle(len(buffIDs), func(i, j int) {
-		buffIDs[i], buffIDs[j] = buffIDs[j], buffIDs[i]
-	})
-
 	cookieParsingLogger.Infof("Total missing buff IDs fetched: %d", len(buffIDs))
 
+	queue := make(chan backend.WorkItem, config.CookieParsing.MaxWorkers)
+	go feedGoodsIDs(ctx, backendClient, buffIDs, queue)
+
 	for {
-		if len(buffIDs) == 0 {
-			cookieParsingLogger.Info("No more buff IDs to process. Waiting for 10 minutes...")
-			time.Sleep(10 * time.Minute)
-			buffIDs, err = fetchCookieParsingBuffIDs("jwtToken")
-			if err != nil {
-				cookieParsingLogger.Error("Error fetching missing buff IDs after waiting:", err)
-			}
-			//TODO check this refetching logic, seems sketchy
-			if len(buffIDs) != 0 {
-				src := rand.NewSource(time.Now().UnixNano())
-				r := rand.New(src)
-				r.Shuffle(len(buffIDs), func(i, j int) {
-					buffIDs[i], buffIDs[j] = buffIDs[j], buffIDs[i]
-				})
-			}
-			continue
+		// Wait for a free worker before taking an item and reserving an account for it
+		if !pool.acquire(ctx) {
+			cookieParsingLogger.Info("Cookie parsing is stopping, waiting for workers to release accounts")
+			return nil
 		}
-
-		// TODO Add resetting locks for accounts
-		time.Sleep(100 * time.Millisecond)
-		account, statusCode, responseBody, err := fetchAccount()
-		if err != nil {
-			cookieParsingLogger.Error("Error fetching account:", err)
-			continue
+		workItem, ok := <-queue
+		if !ok {
+			pool.release()
+			cookieParsingLogger.Info("Cookie parsing is stopping, waiting for workers to release accounts")
+			return nil
 		}
 
-		if statusCode == 200 {
-			wg.Add(1)
-			go workerFunction(account, buffIDs[0])
-			buffIDs = buffIDs[1:]
-			parsedCount++
-			if parsedCount%N == 0 {
-				cookieParsingLogger.Infof("%d buffIds have been processed, %d left", parsedCount, len(buffIDs))
-			}
-		} else if statusCode == 404 {
-			errorResponse := &BackendWaitingTimeResponse{}
-			err = json.Unmarshal(responseBody, errorResponse)
-			if err != nil {
-				cookieParsingLogger.Error("Error decoding error response:", err)
-				continue
+		account, err := reserveAccount(ctx, workCtx, backendClient)
+		if err != nil {
+			pool.release()
+			if ctx.Err() != nil {
+				cookieParsingLogger.Info("Cookie parsing is stopping, waiting for workers to release accounts")
+				return nil
 			}
-			cookieParsingLogger.Info(errorResponse.Message)
-			cookieParsingLogger.Infof("Waiting for %d seconds for new accounts...", errorResponse.WaitingTime)
-			time.Sleep(time.Duration(errorResponse.WaitingTime) * time.Second)
-		} else {
-			cookieParsingLogger.Error("Unexpected status code:", statusCode)
-			wg.Wait()
+			cookieParsingLogger.Error("Unexpected response reserving account:", err)
 			return nil
 		}
+
+		pool.run(func() {
+			parser.workerFunction(workCtx, account, workItem)
+		})
+		parsedCount++
+		if parsedCount%N == 0 {
+			cookieParsingLogger.Infof("%d buffIds have been processed, %d queued", parsedCount, len(queue))
+		}
 	}
 }
 
-func workerFunction(account *Account, goodsID string) {
-	var accountCookieParsingLogger = cookieParsingLogger.WithFields(logrus.Fields{"account": account.ID, "goodsId": goodsID})
-	defer wg.Done() //ensure that the goroutine is closed after executing all of this stuff
-	var successfulReqs, reqs429 int
-	isBanned := false
+// reserveAccount retries reserving an account until it succeeds, ctx is done or the backend responds
+// with an unexpected status. It reserves with workCtx, so a reservation racing with the stop signal
+// isn't lost: such account is released right away.
+func reserveAccount(ctx, workCtx context.Context, backendClient *backend.Client) (*backend.Account, error) {
+	for {
+		// TODO Add resetting locks for accounts
+		if !shutdown.Sleep(ctx, 100*time.Millisecond) {
+			return nil, ctx.Err()
+		}
+		account, err := backendClient.ReserveAccount(workCtx)
+		var noAccountsErr *backend.NoAccountsError
+		var statusErr *backend.StatusError
+		switch {
+		case err == nil && ctx.Err() != nil:
+			releaseAccount(backendClient, backend.AccountRelease{Account: account})
+			return nil, ctx.Err()
+		case err == nil:
+			return account, nil
+		case errors.As(err, &noAccountsErr):
+			cookieParsingLogger.Info(noAccountsErr.Message)
+			cookieParsingLogger.Infof("Waiting for %s for new accounts...", noAccountsErr.WaitingTime)
+			shutdown.Sleep(ctx, noAccountsErr.WaitingTime)
+		case errors.As(err, &statusErr):
+			return nil, err
+		default:
+			cookieParsingLogger.Error("Error fetching account:", err)
+		}
+	}
+}
+
+// cookieParser holds what every cookie parsing worker needs
+type cookieParser struct {
+	backendClient *backend.Client
+	clients       *clientCache
+	config        *configManager.CookieParsingConfig
+	drift         *schemaDrift.Detector
+	converter     *prices.Converter
+	buff          *upstream.Buff
+}
+
+func (p *cookieParser) workerFunction(ctx context.Context, account *backend.Account, workItem backend.WorkItem) {
+	goodsID := workItem.GoodsID
+	session := &accountSession{
+		ctx:     ctx,
+		account: account,
+		logger:  cookieParsingLogger.WithFields(logrus.Fields{"account": account.ID, "goodsId": goodsID, "game": workItem.Game}),
+		config:  p.config,
+		drift:   p.drift,
+		buff:    p.buff,
+		goodsID: goodsID,
+	}
 	defer func() {
-		// Return the account to the backend once the work is completed
-		data := map[string]interface{}{
-			"account":         account,
-			"successful_reqs": successfulReqs,
-			"reqs_429":        reqs429,
-			"is_banned":       isBanned,
+		// Return the account to the backend once the work is completed.
+		// Session cookies are sent back, so the backend stores cookies rotated by buff163
+		cookie, cookieRotated := p.clients.teardown(account)
+		account.Cookie = cookie
+		release := backend.AccountRelease{
+			Account:        account,
+			SuccessfulReqs: session.successfulReqs,
+			Reqs429:        session.reqs429,
+			IsBanned:       session.isBanned,
+			CookieRotated:  cookieRotated,
 		}
-		accountCookieParsingLogger.Debug(data)
-		jsonData, _ := json.Marshal(data)
-		_, err := http.Post("http://localhost/releaseaccount", "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Error("error releasing account")
-			return
+		session.logger.Debug(release)
+		if releaseAccount(p.backendClient, release) {
+			session.logger.Debugf("Finished processing item with goodsId %s", goodsID)
 		}
-		accountCookieParsingLogger.Debugf("Finished processing item with goodsId %s", goodsID)
 	}()
 
-	// Fetch the ProcessedItem from the backend
-	resp, err := http.Get("http://localhost/items/" + goodsID) // Assuming the first ID for simplicity
+	httpClient, err := p.clients.get(account)
 	if err != nil {
-		accountCookieParsingLogger.WithError(err).Errorf("Error fetching itemData from backend, goodsId %s", goodsID)
+		session.logger.WithError(err).Error("Account has invalid proxy")
+		return
+	}
+	session.client = httpClient
+
+	// Fetch the ProcessedItem from the backend
+	var item model.ProcessedItem
+	if err := p.backendClient.GetItem(ctx, goodsID, &item); err != nil {
+		session.logger.WithError(err).Errorf("Error fetching itemData from backend, goodsId %s", goodsID)
 		return
 	}
-	defer resp.Body.Close()
+	item.Game = workItem.Game
 	//TODO optimize this request so we will be updating other data without making non-cookie request
 	//TODO antisybil request
-	_, initialStatusCode, err := makeRequestWithProxy(account.Proxy, account.Cookie, account.UserAgent, fmt.Sprintf("https://buff.163.com/goods/%s", goodsID))
-	if err != nil {
-		accountCookieParsingLogger.WithError(err).Errorf("Error making initial request")
+	if _, ok := session.get(p.buff.GoodsPage(workItem.Game, goodsID), "initial"); !ok {
 		return
 	}
-	switch {
-	case initialStatusCode == http.StatusOK:
-		successfulReqs++
-		interItemSleepDelay(account)
-	case initialStatusCode == http.StatusTooManyRequests:
-		reqs429++
-		accountCookieParsingLogger.Errorf("Account got %d code with initial request", initialStatusCode)
-		return
-	default:
-		accountCookieParsingLogger.Errorf("Received unexpected status %d for initial request", initialStatusCode)
+	if !session.sleep() {
 		return
 	}
 
-	var item ProcessedItem
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&item); err != nil {
-		accountCookieParsingLogger.WithError(err).Errorf("Error decoding ProcessedItem")
+	categories := p.config.CategoriesFor(goodsID)
+	if !session.parseCategories(item.FloatCategory, categories.Float) ||
+		!session.parseCategories(item.FadeCategory, categories.Fade) ||
+		!session.parseCategories(item.StyleCategory, categories.Style) {
 		return
 	}
-
-	//TODO pass it to config(prob)
-	maxCategories := 6
-	if len(item.FloatCategory) < 6 {
-		maxCategories = len(item.FloatCategory)
-	}
-
-	for idx, category := range item.FloatCategory[:maxCategories] {
-		responseData, statusCode, err := makeRequestWithProxy(account.Proxy, account.Cookie, account.UserAgent, category.ApiLink)
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error making request with proxy for category %s\n", category.ApiLink)
-			return
-		}
-
-		// Check for response status codes
-		switch {
-		case statusCode == http.StatusOK:
-			successfulReqs++
-		case statusCode == http.StatusTooManyRequests:
-			reqs429++
-			return
-		case statusCode == http.StatusForbidden: // Handling the 403 Forbidden status code
-			accountCookieParsingLogger.Errorf("403 forbidden response, now this account banned")
-			// Pretty-printing the JSON
-			isBanned = true
-			return
-		default:
-			accountCookieParsingLogger.Errorf("Received unexpected status %d", statusCode)
+	if len(session.listings) > 0 {
+		normalizeListings(session.listings, p.converter)
+		if err := p.backendClient.PostListings(ctx, session.listings); err != nil {
+			session.logger.WithError(err).Errorf("Error sending listings to backend")
 			return
 		}
+	}
 
-		// Decode the response data
-		var result Buff163SellOrdersResponse
-		if err := json.Unmarshal(responseData, &result); err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error decoding response data for category %s", *category.Name)
+	if p.config.BuyOrders {
+		if !session.parseBuyOrders(&item) || !session.sleep() {
 			return
 		}
+	}
 
-		// Check for "Action Forbidden" in the response code
-		if result.Code == "Action Forbidden" {
-			accountCookieParsingLogger.Errorf("Error with categories request, response data: %s", string(responseData))
-			isBanned = true
-			return
-		}
-		if result.Code != "OK" {
-			accountCookieParsingLogger.Errorf("Error with categories request, response data: %s", string(responseData))
-			isBanned = true
-			return
-		}
-		var fvRangePrices []string
-		// Update the item's floatCategory price if there are items in the response
-		if len(result.Data.Items) > 0 {
-			for _, rangeItem := range result.Data.Items {
-				fvRangePrices = append(fvRangePrices, rangeItem.Price)
+	//Fetching price history(graph) from buff163, one request per configured window of days
+	if account.SteamLinked {
+		for i, days := range p.config.PriceHistory.Days {
+			if i > 0 && !session.sleep() {
+				return
 			}
-			item.FloatCategory[idx].ListingsPrices = fvRangePrices
-			price := result.Data.Items[0].Price
-			if &price == nil {
-				accountCookieParsingLogger.Errorf("Price wasn't updated for goodsId %s with code %d. \n Response data: %s\n", goodsID, statusCode, responseData)
+			processedPriceHistory, ok := session.fetchPriceHistory(&item, days)
+			if !ok {
+				return
+			}
+			normalizePriceHistory(processedPriceHistory, p.converter)
+			if err := p.backendClient.PostHistoricalPrices(ctx, processedPriceHistory); err != nil {
+				session.logger.WithError(err).Errorf("Error sending price history to backend")
+				return
 			}
-			item.FloatCategory[idx].Price = &price
 		}
-
-		// Delay between requests
-		interItemSleepDelay(account)
 	}
-	//Fetching price history(graph) from buff163
-	if account.SteamLinked {
-		//fetching graph
-		priceHistoryApiLink := fmt.Sprintf("https://buff.163.com/api/market/goods/price_history/buff?game=csgo&goods_id=%s&currency=USD&days=7&buff_price_type=2&with_sell_num=true", item.GoodsID)
-		responseData, statusCode, err := makeRequestWithProxy(account.Proxy, account.Cookie, account.UserAgent, priceHistoryApiLink)
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error making request with proxy for price history with account Id %d", account.ID)
-			return
-		}
-		switch {
-		case statusCode == http.StatusOK:
-			successfulReqs++
-		case statusCode == http.StatusTooManyRequests:
-			reqs429++
-			return
-		case statusCode == http.StatusForbidden: // Handling the 403 Forbidden status code
-			accountCookieParsingLogger.Errorf("403 forbidden response, now this account banned")
-			isBanned = true
-			return
-		default:
-			accountCookieParsingLogger.Errorf("Received unexpected status %d", statusCode)
-			return
-		}
-
-		var priceHistoryResponse PriceHistoryResponse
-		err = json.Unmarshal(responseData, &priceHistoryResponse)
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error unmarshalling response data for goodsId %s\n", goodsID)
-			return
-		}
-		processedPriceHistory := ResultData{
-			GoodsID:      item.GoodsID,
-			PriceHistory: priceHistoryResponse.Data.PriceHistory,
-		}
 
-		priceHistoryJSON, err := json.Marshal(processedPriceHistory)
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error marshalling price history to JSON")
-			return
-		}
-
-		resp, err = http.Post("http://localhost/historicalprices", "application/json", bytes.NewBuffer(priceHistoryJSON))
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error sending updated item to localhost/historicalprices")
-			return
-		}
-		defer resp.Body.Close()
+	if !session.sleep() {
+		return
 	}
-
-	interItemSleepDelay(account)
 	//Fetching sales from buff163
 	if account.SteamLinked {
 		//fetching graph
-		salesRecordsApiLink := fmt.Sprintf("https://buff.163.com/api/market/goods/bill_order?game=csgo&goods_id=%s", item.GoodsID)
-		responseData, statusCode, err := makeRequestWithProxy(account.Proxy, account.Cookie, account.UserAgent, salesRecordsApiLink)
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error making request with proxy for sale records with account Id %d", account.ID)
-			return
-		}
-		switch {
-		case statusCode == http.StatusOK:
-			successfulReqs++
-		case statusCode == http.StatusTooManyRequests:
-			reqs429++
-			return
-		case statusCode == http.StatusForbidden: // Handling the 403 Forbidden status code
-			accountCookieParsingLogger.Errorf("403 forbidden response, now this account banned")
-			isBanned = true
-			return
-		default:
-			accountCookieParsingLogger.Errorf("Received unexpected status %d", statusCode)
+		salesRecordsApiLink := p.buff.BillOrders(item.Game, item.GoodsID)
+		responseData, ok := session.get(salesRecordsApiLink, "sale records")
+		if !ok || !session.checkSchema(schemaDrift.EndpointBillOrder, billOrderSchema, responseData) {
 			return
 		}
 
 		var saleRecordsResponsense SaleRecordsApiResponse
 		err = json.Unmarshal(responseData, &saleRecordsResponsense)
 		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error unmarshalling sale records response data")
+			session.logger.WithError(err).Errorf("Error unmarshalling sale records response data")
 			return
 		}
-		var processedSaleRecords []ProcessedSaleRecord
+		var processedSaleRecords []model.ProcessedSaleRecord
 		for _, saleRecord := range saleRecordsResponsense.Data.Items {
-			pItem := ProcessedSaleRecord{
-				Stickers: saleRecord.AssetInfo.Info.Stickers,
-				Price:    saleRecord.Price,
-				GoodsID:  saleRecord.AssetInfo.GoodsID,
-				SaleID:   saleRecord.AssetInfo.ID,
-				Date:     saleRecord.TransactTime,
-				Float:    saleRecord.AssetInfo.Paintwear,
-				SellerID: saleRecord.SellerID,
+			pItem := model.ProcessedSaleRecord{
+				Stickers:       saleRecord.AssetInfo.Info.Stickers,
+				Price:          saleRecord.Price,
+				PriceConverted: p.converter.ConvertSource(saleRecord.Price),
+				GoodsID:        saleRecord.AssetInfo.GoodsID,
+				SaleID:         saleRecord.AssetInfo.ID,
+				Date:           saleRecord.TransactTime,
+				Float:          saleRecord.AssetInfo.Paintwear,
+				SellerID:       saleRecord.SellerID,
 			}
 
 			processedSaleRecords = append(processedSaleRecords, pItem)
 		}
 
-		saleRecordsJson, err := json.Marshal(processedSaleRecords)
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error marshalling sale records to JSON")
-			return
-		}
-		accountCookieParsingLogger.Debug("Sale records were processed")
-		resp, err = http.Post("http://localhost/sales", "application/json", bytes.NewBuffer(saleRecordsJson))
-		if err != nil {
-			accountCookieParsingLogger.WithError(err).Errorf("Error sending updated item to localhost/sales")
+		session.logger.Debug("Sale records were processed")
+		if err := p.backendClient.PostSales(ctx, processedSaleRecords); err != nil {
+			session.logger.WithError(err).Errorf("Error sending sale records to backend")
 			return
 		}
-		defer resp.Body.Close()
 	}
 
-	// Send the updated item back to localhost/items
-	jsonItem, err := json.Marshal(item)
-	if err != nil {
-		accountCookieParsingLogger.WithError(err).Errorf("Error marshaling updated item")
+	// Send the updated item back to the backend
+	item.Normalize(p.converter)
+	if err := p.backendClient.PostItem(ctx, item); err != nil {
+		session.logger.WithError(err).Errorf("Error sending updated item to backend")
 		return
 	}
+}
 
-	resp, err = http.Post("http://localhost/items", "application/json", bytes.NewBuffer(jsonItem))
-	if err != nil {
-		accountCookieParsingLogger.WithError(err).Errorf("Error sending updated item to localhost/items")
-		return
+// releaseAccount returns the account to the backend. It doesn't use the worker's context,
+// the account must be released even if the worker was aborted on shutdown.
+func releaseAccount(backendClient *backend.Client, release backend.AccountRelease) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := backendClient.ReleaseAccount(ctx, release); err != nil {
+		cookieParsingLogger.WithError(err).WithField("account", release.Account.ID).Error("error releasing account")
+		return false
 	}
-	defer resp.Body.Close()
+	return true
 }
@@ -0,0 +1,203 @@
+package cookieParsing_test
+
+import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/cookieParsing"
+	"buff163Parser/pkg/mockBackend"
+	"buff163Parser/pkg/mockBuff"
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/testEnv"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// modeConfig has the settings of cookie parsing, the rest come from testEnv
+const modeConfig = `
+mode: cookieParsing
+cookie_parsing:
+  max_workers: 2
+  categories:
+    float:
+      max: 6
+    fade:
+      max: 6
+    style:
+      max: 6
+  pagination:
+    max_pages: 1
+  price_history:
+    currency: USD
+    days: [7]
+    price_type: 2
+`
+
+// cookieEnv adds helpers of cookie parsing tests to the shared environment
+type cookieEnv struct {
+	*testEnv.Env
+}
+
+func newTestEnv(t *testing.T) *cookieEnv {
+	return &cookieEnv{Env: testEnv.New(t, modeConfig)}
+}
+
+func (e *cookieEnv) addAccount(id int) {
+	e.Backend.AddAccount(backend.Account{
+		ID:          id,
+		Cookie:      fmt.Sprintf("session=account-%d", id),
+		SteamLinked: true,
+		Proxy:       e.Buff.ProxyURL(),
+		UserAgent:   "mock-agent",
+	})
+}
+
+// addItem stores an item of the backend with a float and a style category of the goods ID.
+// Category links point to buff.163.com, as stored by the backend.
+func (e *cookieEnv) addItem(t *testing.T, goodsID string) {
+	t.Helper()
+	apiLink := "https://buff.163.com/api/market/goods/sell_order?game=csgo&goods_id=" + goodsID + "&page_num=1&sort_by=default"
+	tier, tagID := "Tier 1", "1001765"
+	item := model.ProcessedItem{
+		GoodsID:        goodsID,
+		MarketHashName: "AK-47 | Case Hardened (Factory New)",
+		FloatCategory:  []model.Category{{Kind: model.KindFloat, Range: []string{"0.00", "0.01"}, ApiLink: apiLink + "&min_paintwear=0.00&max_paintwear=0.01"}},
+		StyleCategory:  []model.Category{{Kind: model.KindTag, Name: &tier, Value: &tagID, ApiLink: apiLink + "&tag_ids=1001765"}},
+	}
+	if err := e.Backend.SetItem(goodsID, item); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// run runs cookie parsing until done reports true, then stops it and waits for it to return
+func (e *cookieEnv) run(t *testing.T, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- cookieParsing.StartCookieParsing(ctx, e.Config, e.BackendClient, e.Upstream)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			cancel()
+			<-result
+			t.Fatal("cookie parsing didn't finish in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cookie parsing didn't stop")
+	}
+}
+
+func TestCookieParsingPostsParsedItem(t *testing.T) {
+	env := newTestEnv(t)
+	env.addAccount(1)
+	env.addItem(t, "1001")
+	env.Backend.SetCookieParsingItems("1001")
+
+	env.run(t, func() bool { return len(env.Backend.Releases()) == 1 })
+
+	items := env.Backend.Posted(mockBackend.PathItems)
+	if len(items) != 1 {
+		t.Fatalf("posted %d items, want 1", len(items))
+	}
+	var item model.ProcessedItem
+	if err := json.Unmarshal(items[0], &item); err != nil {
+		t.Fatal(err)
+	}
+	for _, categories := range [][]model.Category{item.FloatCategory, item.StyleCategory} {
+		category := categories[0]
+		if category.Price == nil || *category.Price != "1205.5" {
+			t.Errorf("category %s price is %v, want 1205.5", category.ApiLink, category.Price)
+		}
+		if len(category.ListingsPrices) != 3 {
+			t.Errorf("category %s has %d listings prices, want 3", category.ApiLink, len(category.ListingsPrices))
+		}
+		if category.PriceConverted == nil || category.PriceConverted.Normalized == nil {
+			t.Errorf("category %s price isn't normalized", category.ApiLink)
+		}
+	}
+
+	var listings []model.ProcessedListing
+	if posted := env.Backend.Posted(mockBackend.PathListings); len(posted) != 1 {
+		t.Fatalf("posted listings %d times, want 1", len(posted))
+	} else if err := json.Unmarshal(posted[0], &listings); err != nil {
+		t.Fatal(err)
+	}
+	// Both categories return the same sell orders, each is posted once
+	if len(listings) != 3 {
+		t.Errorf("posted %d listings, want 3", len(listings))
+	}
+	if n := len(env.Backend.Posted(mockBackend.PathHistoricalPrices)); n != 1 {
+		t.Errorf("posted price history %d times, want 1", n)
+	}
+	if n := len(env.Backend.Posted(mockBackend.PathSales)); n != 1 {
+		t.Errorf("posted sales %d times, want 1", n)
+	}
+
+	release := env.Backend.Releases()[0]
+	if release.IsBanned || release.Reqs429 != 0 {
+		t.Errorf("account released as banned %v with %d 429s", release.IsBanned, release.Reqs429)
+	}
+	if release.SuccessfulReqs != 5 {
+		t.Errorf("account made %d successful requests, want 5", release.SuccessfulReqs)
+	}
+	if !release.CookieRotated || !strings.Contains(release.Account.Cookie, "csrf_token=mock-1001") {
+		t.Errorf("cookie set by buff163 wasn't sent back, got %q", release.Account.Cookie)
+	}
+	for _, request := range env.Buff.Requests() {
+		if !strings.Contains(request.Cookie, "session=account-1") {
+			t.Errorf("request to %s was sent without the account cookie", request.Path)
+		}
+	}
+}
+
+func TestCookieParsingAccountFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		response mockBuff.Response
+		banned   bool
+		reqs429  int
+	}{
+		{name: "forbidden", path: mockBuff.PathSellOrder, response: mockBuff.Forbidden(), banned: true},
+		{name: "action forbidden", path: mockBuff.PathSellOrder, response: mockBuff.ActionForbidden(), banned: true},
+		{name: "too many requests", path: mockBuff.PathGoodsPage, response: mockBuff.TooManyRequests(), reqs429: 1},
+		{name: "malformed", path: mockBuff.PathSellOrder, response: mockBuff.Malformed()},
+		{name: "drifted", path: mockBuff.PathBillOrder, response: mockBuff.Drifted()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.addAccount(1)
+			env.addItem(t, "1001")
+			env.Backend.SetCookieParsingItems("1001")
+			env.Buff.Script(test.path, "1001", test.response)
+
+			env.run(t, func() bool { return len(env.Backend.Releases()) == 1 })
+
+			if n := len(env.Backend.Posted(mockBackend.PathItems)); n != 0 {
+				t.Errorf("posted %d items, want none", n)
+			}
+			release := env.Backend.Releases()[0]
+			if release.IsBanned != test.banned {
+				t.Errorf("account released as banned %v, want %v", release.IsBanned, test.banned)
+			}
+			if release.Reqs429 != test.reqs429 {
+				t.Errorf("account released with %d 429s, want %d", release.Reqs429, test.reqs429)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package games
+
+import "fmt"
+
+// Game is the value of the game parameter of buff163 APIs
+type Game string
+
+const (
+	CSGO  Game = "csgo"
+	Dota2 Game = "dota2"
+	Rust  Game = "rust"
+	TF2   Game = "tf2"
+)
+
+// Default is the game of work items that don't name one
+const Default = CSGO
+
+// Parse validates the name of a game, an empty name is the default game
+func Parse(name string) (Game, error) {
+	switch game := Game(name); game {
+	case "":
+		return Default, nil
+	case CSGO, Dota2, Rust, TF2:
+		return game, nil
+	default:
+		return "", fmt.Errorf("unsupported game %q", name)
+	}
+}
+
+// HasPaintwear reports whether items of the game have float (paintwear) and fade
+func (g Game) HasPaintwear() bool {
+	return g == CSGO
+}
@@ -0,0 +1,245 @@
+package mockBackend
+
+import (
+	"buff163Parser/pkg/backend"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is the only API key the fake backend signs in
+const APIKey = "mock-api-key"
+
+// Paths of the backend endpoints, the defaults of configManager
+const (
+	PathSignIn             = "/auth/signin"
+	PathReserveAccount     = "/reserveAccount"
+	PathReleaseAccount     = "/releaseaccount"
+	PathResetAccounts      = "/resetaccounts"
+	PathCookieParsingItems = "/cookieparsingitems"
+	PathMissingBuffIDs     = "/missingbuffids"
+	PathParsingProxies     = "/fetchParsingProxies"
+	PathItems              = "/items"
+	PathSales              = "/sales"
+	PathHistoricalPrices   = "/historicalprices"
+	PathListings           = "/listings"
+)
+
+// Backend is a fake parser backend on httptest. It hands out accounts and work items it was given
+// and records everything the parser posts.
+type Backend struct {
+	server *httptest.Server
+	token  string
+
+	mu                 sync.Mutex
+	accounts           []*backend.Account
+	locked             map[int]bool
+	items              map[string]json.RawMessage
+	cookieParsingItems []string
+	missingRounds      [][]string
+	proxies            []string
+	posted             map[string][]json.RawMessage
+	releases           []backend.AccountRelease
+	calls              map[string]int
+}
+
+func NewBackend() *Backend {
+	b := &Backend{
+		token:  newToken(time.Now().Add(time.Hour)),
+		locked: make(map[int]bool),
+		items:  make(map[string]json.RawMessage),
+		posted: make(map[string][]json.RawMessage),
+		calls:  make(map[string]int),
+	}
+	b.server = httptest.NewServer(http.HandlerFunc(b.serve))
+	return b
+}
+
+// newToken makes an unsigned JWT with the exp claim, the parser doesn't verify signatures
+func newToken(expiresAt time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	claims := fmt.Sprintf(`{"sub":"parser","exp":%d}`, expiresAt.Unix())
+	return encode([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + encode([]byte(claims)) + ".mock"
+}
+
+// URL is the base_url of the backend
+func (b *Backend) URL() string {
+	return b.server.URL
+}
+
+func (b *Backend) Close() {
+	b.server.Close()
+}
+
+// AddAccount adds an account that can be reserved
+func (b *Backend) AddAccount(account backend.Account) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accounts = append(b.accounts, &account)
+}
+
+// SetItem stores the item returned by GET /items/<goodsID>
+func (b *Backend) SetItem(goodsID string, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items[goodsID] = data
+	return nil
+}
+
+// SetCookieParsingItems sets the work items of cookie parsing, as plain goods IDs or JSON objects
+func (b *Backend) SetCookieParsingItems(items ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cookieParsingItems = items
+}
+
+// AddMissingBuffIDsRound queues work items returned by a single missing buff IDs call.
+// Once all rounds are returned the endpoint returns no items.
+func (b *Backend) AddMissingBuffIDsRound(items ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.missingRounds = append(b.missingRounds, items)
+}
+
+// SetProxies sets the parsing proxies
+func (b *Backend) SetProxies(proxies ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.proxies = proxies
+}
+
+// Posted returns bodies posted to the path
+func (b *Backend) Posted(path string) []json.RawMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]json.RawMessage(nil), b.posted[path]...)
+}
+
+// Releases returns the accounts released so far
+func (b *Backend) Releases() []backend.AccountRelease {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]backend.AccountRelease(nil), b.releases...)
+}
+
+// Calls returns the number of requests to the path
+func (b *Backend) Calls(path string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[path]
+}
+
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := r.URL.Path
+	goodsID := ""
+	if strings.HasPrefix(path, PathItems+"/") {
+		goodsID = strings.TrimPrefix(path, PathItems+"/")
+		path = PathItems
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls[path]++
+
+	if path == PathSignIn {
+		var request struct {
+			APIKey string `json:"api_key"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil || request.APIKey != APIKey {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"token": b.token})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+b.token {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case path == PathReserveAccount:
+		for _, account := range b.accounts {
+			if !b.locked[account.ID] {
+				b.locked[account.ID] = true
+				writeJSON(w, http.StatusOK, account)
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": "No free accounts", "waitingTime": 1})
+	case path == PathReleaseAccount:
+		var release backend.AccountRelease
+		if err := json.Unmarshal(body, &release); err != nil || release.Account == nil {
+			http.Error(w, "invalid release", http.StatusBadRequest)
+			return
+		}
+		b.locked[release.Account.ID] = false
+		b.releases = append(b.releases, release)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "released"})
+	case path == PathResetAccounts:
+		b.locked = make(map[int]bool)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+	case path == PathCookieParsingItems:
+		writeRawItems(w, b.cookieParsingItems)
+	case path == PathMissingBuffIDs:
+		var round []string
+		if len(b.missingRounds) > 0 {
+			round, b.missingRounds = b.missingRounds[0], b.missingRounds[1:]
+		}
+		writeRawItems(w, round)
+	case path == PathParsingProxies:
+		writeJSON(w, http.StatusOK, b.proxies)
+	case path == PathItems && r.Method == http.MethodGet:
+		item, ok := b.items[goodsID]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(item)
+	case r.Method == http.MethodPost && (path == PathItems || path == PathSales || path == PathHistoricalPrices || path == PathListings):
+		if !json.Valid(body) {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		b.posted[path] = append(b.posted[path], body)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "saved"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeRawItems writes work items, plain goods IDs become JSON strings and JSON objects are kept
+func writeRawItems(w http.ResponseWriter, items []string) {
+	raw := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		if strings.HasPrefix(item, "{") {
+			raw = append(raw, json.RawMessage(item))
+			continue
+		}
+		encoded, _ := json.Marshal(item)
+		raw = append(raw, encoded)
+	}
+	writeJSON(w, http.StatusOK, raw)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,208 @@
+package mockBuff
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"embed"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// Paths of the buff163 APIs the parser requests
+const (
+	PathGoodsPage    = "/goods/"
+	PathGoodsInfo    = "/api/market/goods/info"
+	PathSellOrder    = "/api/market/goods/sell_order"
+	PathBuyOrder     = "/api/market/goods/buy_order"
+	PathPriceHistory = "/api/market/goods/price_history/buff"
+	PathBillOrder    = "/api/market/goods/bill_order"
+)
+
+var fixtureFiles = map[string]string{
+	PathGoodsInfo:    "fixtures/goods_info.json",
+	PathSellOrder:    "fixtures/sell_order.json",
+	PathBuyOrder:     "fixtures/buy_order.json",
+	PathPriceHistory: "fixtures/price_history.json",
+	PathBillOrder:    "fixtures/bill_order.json",
+}
+
+// Response is a scripted response served instead of the fixture
+type Response struct {
+	Status int
+	Body   string
+}
+
+// TooManyRequests is the response buff163 gives to an account or proxy sending requests too fast
+func TooManyRequests() Response {
+	return Response{Status: http.StatusTooManyRequests, Body: `{"code":"Too Many Requests"}`}
+}
+
+// Forbidden is the response buff163 gives to a banned account
+func Forbidden() Response {
+	return Response{Status: http.StatusForbidden, Body: "<html>403 Forbidden</html>"}
+}
+
+// ActionForbidden is the response buff163 gives with 200 when an account may not use the API anymore
+func ActionForbidden() Response {
+	return Response{Status: http.StatusOK, Body: `{"code":"Action Forbidden","msg":"Action Forbidden"}`}
+}
+
+// Malformed is a truncated JSON body
+func Malformed() Response {
+	return Response{Status: http.StatusOK, Body: `{"code":"OK","data":{"items":[`}
+}
+
+// Drifted is a JSON body of OK code with data of an unexpected shape
+func Drifted() Response {
+	return Response{Status: http.StatusOK, Body: `{"code":"OK","data":"moved to data_v2"}`}
+}
+
+// Request is a request the server has received
+type Request struct {
+	Path    string
+	GoodsID string
+	Query   string
+	Cookie  string
+}
+
+type scriptKey struct {
+	path    string
+	goodsID string
+}
+
+// Server is a fake buff.163.com. It serves fixtures over TLS for buff.163.com and 127.0.0.1 and is reached
+// through its HTTP or SOCKS5 proxy, so parser clients are used as they are in production.
+type Server struct {
+	tlsServer *httptest.Server
+	proxy     *httptest.Server
+	socks     net.Listener
+	certPool  *x509.CertPool
+
+	mu       sync.Mutex
+	scripts  map[scriptKey][]Response
+	requests []Request
+}
+
+// NewServer starts the fake buff163 and its proxies. Close stops them.
+func NewServer() (*Server, error) {
+	cert, certPool, err := newCertificate("buff.163.com")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{certPool: certPool, scripts: make(map[scriptKey][]Response)}
+	s.tlsServer = httptest.NewUnstartedServer(http.HandlerFunc(s.serveBuff))
+	s.tlsServer.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.tlsServer.StartTLS()
+	s.proxy = httptest.NewServer(http.HandlerFunc(s.serveProxy))
+	s.socks, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	go s.serveSOCKS(s.socks)
+	return s, nil
+}
+
+// URL is the base URL of the server, to use as buff base_url
+func (s *Server) URL() string {
+	return s.tlsServer.URL
+}
+
+// ProxyURL is the URL of the proxy to give to accounts and parsing proxies
+func (s *Server) ProxyURL() string {
+	return s.proxy.URL
+}
+
+// SOCKSProxyURL is the URL of the SOCKS5 proxy, it resolves target hosts itself
+func (s *Server) SOCKSProxyURL() string {
+	return "socks5h://" + s.socks.Addr().String()
+}
+
+// CertPool trusts the certificate the server presents for buff.163.com
+func (s *Server) CertPool() *x509.CertPool {
+	return s.certPool
+}
+
+// WrapTransport makes a proxied transport of the parser trust the server, it's meant for upstream.Buff Transport
+func (s *Server) WrapTransport(proxied http.RoundTripper) http.RoundTripper {
+	transport, ok := proxied.(*http.Transport)
+	if !ok {
+		return proxied
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: s.certPool}
+	return transport
+}
+
+func (s *Server) Close() {
+	if s.socks != nil {
+		s.socks.Close()
+	}
+	s.proxy.Close()
+	s.tlsServer.Close()
+}
+
+// Script queues responses served for requests to path about the goods ID instead of the fixture, in order
+func (s *Server) Script(path, goodsID string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := scriptKey{path: path, goodsID: goodsID}
+	s.scripts[key] = append(s.scripts[key], responses...)
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serveBuff(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	goodsID := r.URL.Query().Get("goods_id")
+	if strings.HasPrefix(path, PathGoodsPage) {
+		goodsID = strings.TrimPrefix(path, PathGoodsPage)
+		path = PathGoodsPage
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Path: path, GoodsID: goodsID, Query: r.URL.RawQuery, Cookie: r.Header.Get("Cookie")})
+	key := scriptKey{path: path, goodsID: goodsID}
+	scripted, ok := s.scripts[key], len(s.scripts[key]) > 0
+	if ok {
+		s.scripts[key] = scripted[1:]
+	}
+	s.mu.Unlock()
+
+	if ok {
+		w.WriteHeader(scripted[0].Status)
+		fmt.Fprint(w, scripted[0].Body)
+		return
+	}
+
+	if path == PathGoodsPage {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: "mock-" + goodsID, Path: "/"})
+		fmt.Fprintf(w, "<html><body>goods %s</body></html>", goodsID)
+		return
+	}
+	file, ok := fixtureFiles[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := fixtures.ReadFile(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
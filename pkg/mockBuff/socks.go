@@ -0,0 +1,139 @@
+package mockBuff
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+)
+
+// SOCKS5 protocol bytes, see RFC 1928 and RFC 1929
+const (
+	socksVersion         = 0x05
+	socksAuthNone        = 0x00
+	socksAuthPassword    = 0x02
+	socksAuthUnsupported = 0xff
+	socksPasswordVersion = 0x01
+	socksConnect         = 0x01
+	socksAddrIPv4        = 0x01
+	socksAddrDomain      = 0x03
+	socksAddrIPv6        = 0x04
+)
+
+// serveSOCKS accepts SOCKS5 connections until the listener is closed
+func (s *Server) serveSOCKS(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleSOCKS(conn)
+	}
+}
+
+// handleSOCKS tunnels a CONNECT of any target to the TLS server, like the HTTP proxy does.
+// Any username and password are accepted.
+func (s *Server) handleSOCKS(client net.Conn) {
+	reader := bufio.NewReader(client)
+	if err := socksHandshake(reader, client); err != nil {
+		client.Close()
+		return
+	}
+	target, err := net.Dial("tcp", s.tlsServer.Listener.Addr().String())
+	if err != nil {
+		client.Write([]byte{socksVersion, 0x01, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+		client.Close()
+		return
+	}
+	if _, err := client.Write([]byte{socksVersion, 0x00, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0}); err != nil {
+		client.Close()
+		target.Close()
+		return
+	}
+
+	go func() {
+		defer target.Close()
+		io.Copy(target, reader)
+	}()
+	go func() {
+		defer client.Close()
+		io.Copy(client, target)
+	}()
+}
+
+// socksHandshake negotiates authentication and reads the CONNECT request, the target is ignored
+func socksHandshake(reader *bufio.Reader, client net.Conn) error {
+	greeting, err := readBytes(reader, 2)
+	if err != nil {
+		return err
+	}
+	if greeting[0] != socksVersion {
+		return errors.New("not a SOCKS5 client")
+	}
+	methods, err := readBytes(reader, int(greeting[1]))
+	if err != nil {
+		return err
+	}
+	method := byte(socksAuthUnsupported)
+	for _, offered := range methods {
+		if offered == socksAuthPassword || offered == socksAuthNone && method != socksAuthPassword {
+			method = offered
+		}
+	}
+	if _, err := client.Write([]byte{socksVersion, method}); err != nil {
+		return err
+	}
+	switch method {
+	case socksAuthUnsupported:
+		return errors.New("no supported authentication method")
+	case socksAuthPassword:
+		// version, username and password, each with its length
+		if _, err := readBytes(reader, 1); err != nil {
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			length, err := readBytes(reader, 1)
+			if err != nil {
+				return err
+			}
+			if _, err := readBytes(reader, int(length[0])); err != nil {
+				return err
+			}
+		}
+		if _, err := client.Write([]byte{socksPasswordVersion, 0x00}); err != nil {
+			return err
+		}
+	}
+
+	request, err := readBytes(reader, 4)
+	if err != nil {
+		return err
+	}
+	if request[0] != socksVersion || request[1] != socksConnect {
+		return errors.New("only CONNECT is supported")
+	}
+	var addrLength int
+	switch request[3] {
+	case socksAddrIPv4:
+		addrLength = net.IPv4len
+	case socksAddrIPv6:
+		addrLength = net.IPv6len
+	case socksAddrDomain:
+		length, err := readBytes(reader, 1)
+		if err != nil {
+			return err
+		}
+		addrLength = int(length[0])
+	default:
+		return errors.New("unknown address type")
+	}
+	// The address and the port
+	_, err = readBytes(reader, addrLength+2)
+	return err
+}
+
+func readBytes(reader *bufio.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(reader, buf)
+	return buf, err
+}
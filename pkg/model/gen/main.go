@@ -0,0 +1,19 @@
+// Command gen writes JSON Schema documents of the backend payloads to pkg/model/schemas.
+// It's run by go generate in pkg/model.
+package main
+
+import (
+	"buff163Parser/pkg/model"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	root := flag.String("dir", "schemas", "directory the documents are written to, by schema version")
+	flag.Parse()
+	if err := model.WriteSchemas(*root); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
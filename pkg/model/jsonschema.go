@@ -0,0 +1,227 @@
+package model
+
+import (
+	"buff163Parser/pkg/games"
+	"buff163Parser/pkg/prices"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonSchemaDialect is the JSON Schema draft the documents are written in
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Types is the type keyword of a JSON Schema, written as a string when there is a single type
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func (t Types) contains(name string) bool {
+	for _, typ := range t {
+		if typ == name {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONSchema is the subset of JSON Schema the payloads are described with
+type JSONSchema struct {
+	Dialect              string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Version              int                    `json:"x-schema-version,omitempty"`
+	Type                 Types                  `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// jsonShapes maps types with their own MarshalJSON to types of the same JSON shape
+var jsonShapes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(ProcessedItem{}):       reflect.TypeOf(processedItemJSON{}),
+	reflect.TypeOf(Category{}):            reflect.TypeOf(categoryJSON{}),
+	reflect.TypeOf(ResultData{}):          reflect.TypeOf(resultDataJSON{}),
+	reflect.TypeOf(ProcessedSaleRecord{}): reflect.TypeOf(saleRecordJSON{}),
+	reflect.TypeOf(ProcessedListing{}):    reflect.TypeOf(listingJSON{}),
+	reflect.TypeOf(prices.Price{}): reflect.TypeOf(struct {
+		Amount     string `json:"amount"`
+		MinorUnits int64  `json:"minor_units"`
+		Currency   string `json:"currency"`
+	}{}),
+}
+
+// jsonEnums are the values of string types with a closed set of values
+var jsonEnums = map[reflect.Type][]string{
+	reflect.TypeOf(games.Game("")):   {string(games.CSGO), string(games.Dota2), string(games.Rust), string(games.TF2)},
+	reflect.TypeOf(CategoryKind("")): {string(KindFloat), string(KindFade), string(KindTag), string(KindFilter)},
+}
+
+// GenerateJSONSchema describes the JSON encoding/json writes for values of the payload type
+func GenerateJSONSchema(title string, payload interface{}) *JSONSchema {
+	schema := schemaOf(reflect.TypeOf(payload))
+	schema.Dialect = jsonSchemaDialect
+	schema.Title = title
+	schema.Version = SchemaVersion
+	return schema
+}
+
+func schemaOf(t reflect.Type) *JSONSchema {
+	if shape, ok := jsonShapes[t]; ok {
+		t = shape
+	}
+	if values, ok := jsonEnums[t]; ok {
+		return &JSONSchema{Type: Types{"string"}, Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Struct:
+		schema := &JSONSchema{Type: Types{"object"}, Properties: make(map[string]*JSONSchema)}
+		addProperties(schema, t)
+		sort.Strings(schema.Required)
+		return schema
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: Types{"array"}, Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: Types{"object"}, AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.String:
+		return &JSONSchema{Type: Types{"string"}}
+	case reflect.Bool:
+		return &JSONSchema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: Types{"number"}}
+	}
+	// interface{} and the like may hold anything
+	return &JSONSchema{}
+}
+
+// addProperties adds fields of the struct as encoding/json writes them. Fields of embedded structs are promoted,
+// fields without omitempty are required, pointers, slices and maps without omitempty may be null.
+func addProperties(schema *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(schema, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOf(field.Type)
+		omitEmpty := strings.Contains(options, "omitempty")
+		if !omitEmpty {
+			schema.Required = append(schema.Required, name)
+			switch field.Type.Kind() {
+			case reflect.Pointer, reflect.Slice, reflect.Map:
+				property.Type = append(property.Type, "null")
+			}
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// CompatibilityProblems lists changes of the schema that break readers of payloads written with the baseline:
+// removed or retyped properties, properties that stopped being required, types that newly allow other values
+// and enums that gained, lost or stopped enforcing values.
+func CompatibilityProblems(baseline, current *JSONSchema) []string {
+	var problems []string
+	compareSchemas("$", baseline, current, &problems)
+	return problems
+}
+
+func compareSchemas(path string, baseline, current *JSONSchema, problems *[]string) {
+	for _, typ := range current.Type {
+		if len(baseline.Type) > 0 && !baseline.Type.contains(typ) {
+			*problems = append(*problems, fmt.Sprintf("%s: type changed from %v to %v", path, []string(baseline.Type), []string(current.Type)))
+			return
+		}
+	}
+	if len(baseline.Type) > 0 && len(current.Type) == 0 {
+		*problems = append(*problems, fmt.Sprintf("%s: type %v is no longer enforced", path, []string(baseline.Type)))
+	}
+	compareEnums(path, baseline.Enum, current.Enum, problems)
+
+	names := make([]string, 0, len(baseline.Properties))
+	for name := range baseline.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := current.Properties[name]
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s.%s: removed", path, name))
+			continue
+		}
+		compareSchemas(path+"."+name, baseline.Properties[name], property, problems)
+	}
+
+	required := make(map[string]bool, len(current.Required))
+	for _, name := range current.Required {
+		required[name] = true
+	}
+	for _, name := range baseline.Required {
+		if _, exists := current.Properties[name]; exists && !required[name] {
+			*problems = append(*problems, fmt.Sprintf("%s.%s: no longer required", path, name))
+		}
+	}
+
+	if baseline.Items != nil {
+		if current.Items == nil {
+			*problems = append(*problems, fmt.Sprintf("%s[]: items are no longer described", path))
+		} else {
+			compareSchemas(path+"[]", baseline.Items, current.Items, problems)
+		}
+	}
+	if baseline.AdditionalProperties != nil && current.AdditionalProperties != nil {
+		compareSchemas(path+"{}", baseline.AdditionalProperties, current.AdditionalProperties, problems)
+	}
+}
+
+// compareEnums reports values added to or removed from the enum. Readers of the baseline don't expect
+// new values and payloads written with the baseline may still have the removed ones.
+func compareEnums(path string, baseline, current []string, problems *[]string) {
+	if len(baseline) == 0 {
+		return
+	}
+	if len(current) == 0 {
+		*problems = append(*problems, fmt.Sprintf("%s: enum %v is no longer enforced", path, baseline))
+		return
+	}
+	for _, value := range current {
+		if !Types(baseline).contains(value) {
+			*problems = append(*problems, fmt.Sprintf("%s: enum value %q added", path, value))
+		}
+	}
+	for _, value := range baseline {
+		if !Types(current).contains(value) {
+			*problems = append(*problems, fmt.Sprintf("%s: enum value %q removed", path, value))
+		}
+	}
+}
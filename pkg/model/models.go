@@ -0,0 +1,178 @@
+package model
+
+import (
+	"buff163Parser/pkg/buyOrders"
+	"buff163Parser/pkg/games"
+	"buff163Parser/pkg/prices"
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the item JSON exchanged with the backend. Bump it with every change
+// of the JSON of ProcessedItem or Category.
+const SchemaVersion = 1
+
+// UnsupportedVersionError is returned when decoding an item written with a newer schema than SchemaVersion
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("item schema version %d is newer than supported version %d", e.Version, SchemaVersion)
+}
+
+// ProcessedItem is an item as the backend stores it. Non-cookie parsing creates it from goods info,
+// cookie parsing fetches it from the backend and fills prices of its categories.
+type ProcessedItem struct {
+	// SchemaVersion is always written as the current SchemaVersion, items without it are of version 0
+	SchemaVersion   int        `json:"schema_version"`
+	GoodsID         string     `json:"goodsid"`
+	Game            games.Game `json:"game"`
+	MarketHashName  string     `json:"markethashname"`
+	ListingPrice    string     `json:"listingprice"`
+	Listings        int        `json:"listings"`
+	BuyOrders       int        `json:"buyorders"`
+	BuyOrderPrice   string     `json:"buyorderprice"`
+	SteamMarketLink string     `json:"steammarketlink"`
+	FadeCategory    []Category `json:"fadecategory"`
+	StyleCategory   []Category `json:"stylecategory"`
+	FloatCategory   []Category `json:"floatcategory"`
+	// BuyOrderBook is the first page of buy orders, filled only if buy_orders is enabled for the mode
+	BuyOrderBook []buyOrders.BuyOrder `json:"buyorderbook,omitempty"`
+	// ListingPriceConverted and BuyOrderPriceConverted carry the prices along with their normalized values
+	ListingPriceConverted  *prices.Converted `json:"listingprice_converted,omitempty"`
+	BuyOrderPriceConverted *prices.Converted `json:"buyorderprice_converted,omitempty"`
+}
+
+// processedItemJSON has the fields of ProcessedItem without its methods
+type processedItemJSON ProcessedItem
+
+func (item ProcessedItem) MarshalJSON() ([]byte, error) {
+	item.SchemaVersion = SchemaVersion
+	return json.Marshal(processedItemJSON(item))
+}
+
+// UnmarshalJSON decodes items of every version up to SchemaVersion. Categories of version 0
+// get their kind from the list they are in.
+func (item *ProcessedItem) UnmarshalJSON(data []byte) error {
+	var decoded processedItemJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.SchemaVersion > SchemaVersion {
+		return &UnsupportedVersionError{Version: decoded.SchemaVersion}
+	}
+	setMissingKind(decoded.FloatCategory, KindFloat)
+	setMissingKind(decoded.FadeCategory, KindFade)
+	*item = ProcessedItem(decoded)
+	return nil
+}
+
+func setMissingKind(categories []Category, kind CategoryKind) {
+	for i := range categories {
+		if categories[i].Kind == "" {
+			categories[i].Kind = kind
+		}
+	}
+}
+
+// Categories returns float, fade and style categories of the item
+func (item *ProcessedItem) Categories() [][]Category {
+	return [][]Category{item.FloatCategory, item.FadeCategory, item.StyleCategory}
+}
+
+// CategoryKind tells what a category filters sell orders of an item by
+type CategoryKind string
+
+const (
+	// KindFloat categories are ranges of paintwear, filtered by min_paintwear and max_paintwear
+	KindFloat CategoryKind = "float"
+	// KindFade categories are ranges of fade percentage, filtered by min_fade and max_fade
+	KindFade CategoryKind = "fade"
+	// KindTag categories are asset tags like Case Hardened tiers, filtered by tag_ids
+	KindTag CategoryKind = "tag"
+	// KindFilter categories are paintseed filters like Doppler phases or Dota 2 gems, filtered by the filter type
+	KindFilter CategoryKind = "filter"
+)
+
+// tagParameter is the sell_order parameter of asset tags
+const tagParameter = "tag_ids"
+
+// Known reports whether the kind is one of this version. Newer producers may write other kinds,
+// such categories are kept as they are and consumers skip them
+func (k CategoryKind) Known() bool {
+	switch k {
+	case KindFloat, KindFade, KindTag, KindFilter:
+		return true
+	}
+	return false
+}
+
+// Ranged reports whether categories of the kind are ranges rather than named values
+func (k CategoryKind) Ranged() bool {
+	return k == KindFloat || k == KindFade
+}
+
+type Category struct {
+	Kind    CategoryKind `json:"kind"`
+	Range   []string     `json:"range,omitempty"`
+	Price   *string      `json:"price"`
+	ApiLink string       `json:"apiLink"`
+	Name    *string      `json:"name,omitempty"`
+	Value   *string      `json:"value,omitempty"`
+	// Filter is the paintseed filter type of KindFilter categories, e.g. "tier" or "phase"
+	Filter string `json:"filter,omitempty"`
+	// ListingsPrices are prices of the listings found by cookie parsing, cheapest first
+	ListingsPrices []string `json:"listingsprices,omitempty"`
+	// PriceConverted and ListingsPricesConverted carry the prices along with their normalized values
+	PriceConverted          *prices.Converted  `json:"price_converted,omitempty"`
+	ListingsPricesConverted []prices.Converted `json:"listingsprices_converted,omitempty"`
+}
+
+// Parameter returns the sell_order parameter Value is passed in, empty for ranged categories
+func (c *Category) Parameter() string {
+	switch c.Kind {
+	case KindTag:
+		return tagParameter
+	case KindFilter:
+		return c.Filter
+	}
+	return ""
+}
+
+// categoryJSON has the fields of Category without its methods, along with the parameter the backend
+// used to get before categories had a kind
+type categoryJSON struct {
+	categoryFields
+	Parameter *string `json:"parameter,omitempty"`
+}
+
+type categoryFields Category
+
+func (c Category) MarshalJSON() ([]byte, error) {
+	encoded := categoryJSON{categoryFields: categoryFields(c)}
+	if parameter := c.Parameter(); parameter != "" {
+		encoded.Parameter = &parameter
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes categories with a kind and categories of version 0, whose kind comes from
+// the parameter. Ranged categories of version 0 get the kind from the item. Unknown kinds are kept.
+func (c *Category) UnmarshalJSON(data []byte) error {
+	var decoded categoryJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*c = Category(decoded.categoryFields)
+	if c.Kind != "" || decoded.Parameter == nil {
+		return nil
+	}
+	if *decoded.Parameter == tagParameter {
+		c.Kind = KindTag
+	} else {
+		c.Kind = KindFilter
+		c.Filter = *decoded.Parameter
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"buff163Parser/pkg/buyOrders"
+	"buff163Parser/pkg/games"
+	"buff163Parser/pkg/prices"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func pointer(s string) *string {
+	return &s
+}
+
+func converted(t *testing.T, amount string) *prices.Converted {
+	t.Helper()
+	original, err := prices.Parse(amount, "CNY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalized, err := prices.Parse("1.50", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &prices.Converted{Original: original, Normalized: &normalized}
+}
+
+func fullItem(t *testing.T) ProcessedItem {
+	t.Helper()
+	return ProcessedItem{
+		SchemaVersion:   SchemaVersion,
+		GoodsID:         "35213",
+		Game:            games.CSGO,
+		MarketHashName:  "AK-47 | Case Hardened (Factory New)",
+		ListingPrice:    "1205.5",
+		Listings:        35,
+		BuyOrders:       12,
+		BuyOrderPrice:   "1100",
+		SteamMarketLink: "https://steamcommunity.com/market/listings/730/AK-47",
+		FloatCategory: []Category{{
+			Kind:                    KindFloat,
+			Range:                   []string{"0.00", "0.01"},
+			Price:                   pointer("1205.5"),
+			ApiLink:                 "https://buff.163.com/api/market/goods/sell_order?goods_id=35213&min_paintwear=0.00&max_paintwear=0.01",
+			ListingsPrices:          []string{"1205.5"},
+			PriceConverted:          converted(t, "1205.5"),
+			ListingsPricesConverted: []prices.Converted{*converted(t, "1205.5")},
+		}},
+		FadeCategory: []Category{{Kind: KindFade, Range: []string{"80", "90"}, ApiLink: "https://buff.163.com/fade"}},
+		StyleCategory: []Category{
+			{Kind: KindTag, Name: pointer("Tier 1"), Value: pointer("1001765"), ApiLink: "https://buff.163.com/tag"},
+			{Kind: KindFilter, Name: pointer("Phase 2"), Value: pointer("phase2"), Filter: "phase", ApiLink: "https://buff.163.com/phase"},
+		},
+		BuyOrderBook: []buyOrders.BuyOrder{{
+			ID:          "order-1",
+			Price:       "1100",
+			Quantity:    2,
+			BuyerID:     "U1",
+			Constraints: []buyOrders.Constraint{{Type: "paintseed", Values: []string{"661"}}},
+		}},
+		ListingPriceConverted:  converted(t, "1205.5"),
+		BuyOrderPriceConverted: converted(t, "1100"),
+	}
+}
+
+func TestProcessedItemRoundTrip(t *testing.T) {
+	item := fullItem(t)
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ProcessedItem
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, item) {
+		t.Errorf("item changed in round trip:\n got %+v\nwant %+v", decoded, item)
+	}
+}
+
+func TestProcessedItemWritesCurrentVersion(t *testing.T) {
+	item := fullItem(t)
+	item.SchemaVersion = 0
+	data, err := json.Marshal(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if string(fields["schema_version"]) != "1" {
+		t.Errorf("schema_version is %s, want %d", fields["schema_version"], SchemaVersion)
+	}
+}
+
+func TestCategoryWritesParameter(t *testing.T) {
+	tests := []struct {
+		category  Category
+		parameter string
+	}{
+		{Category{Kind: KindTag, Value: pointer("1001765")}, `"parameter":"tag_ids"`},
+		{Category{Kind: KindFilter, Value: pointer("phase2"), Filter: "phase"}, `"parameter":"phase"`},
+		{Category{Kind: KindFloat, Range: []string{"0.00", "0.01"}}, ""},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.parameter == "" && strings.Contains(string(data), `"parameter"`) {
+			t.Errorf("%s category was written with parameter: %s", test.category.Kind, data)
+		}
+		if test.parameter != "" && !strings.Contains(string(data), test.parameter) {
+			t.Errorf("%s category was written without %s: %s", test.category.Kind, test.parameter, data)
+		}
+	}
+}
+
+func TestLegacyItemGetsKinds(t *testing.T) {
+	legacy := `{
+		"goodsid": "35213",
+		"floatcategory": [{"range": ["0.00", "0.01"], "price": null, "apiLink": "float"}],
+		"fadecategory": [{"range": ["80", "90"], "price": null, "apiLink": "fade"}],
+		"stylecategory": [
+			{"price": "10", "apiLink": "tag", "name": "Tier 1", "value": "1001765", "parameter": "tag_ids"},
+			{"price": null, "apiLink": "phase", "name": "Phase 2", "value": "phase2", "parameter": "phase"}
+		]
+	}`
+	var item ProcessedItem
+	if err := json.Unmarshal([]byte(legacy), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.SchemaVersion != 0 {
+		t.Errorf("legacy item has version %d, want 0", item.SchemaVersion)
+	}
+	kinds := []CategoryKind{item.FloatCategory[0].Kind, item.FadeCategory[0].Kind, item.StyleCategory[0].Kind, item.StyleCategory[1].Kind}
+	if want := []CategoryKind{KindFloat, KindFade, KindTag, KindFilter}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("legacy categories got kinds %v, want %v", kinds, want)
+	}
+	if filter := item.StyleCategory[1]; filter.Filter != "phase" || filter.Parameter() != "phase" {
+		t.Errorf("legacy filter category got filter %q", filter.Filter)
+	}
+}
+
+func TestNewerVersionIsRejected(t *testing.T) {
+	var item ProcessedItem
+	err := json.Unmarshal([]byte(`{"schema_version": 2, "goodsid": "35213"}`), &item)
+	var versionErr *UnsupportedVersionError
+	if !errors.As(err, &versionErr) || versionErr.Version != 2 {
+		t.Errorf("decoding a newer item returned %v, want UnsupportedVersionError", err)
+	}
+}
+
+func TestUnknownKindIsKept(t *testing.T) {
+	data := []byte(`{"schema_version": 1, "goodsid": "35213", "stylecategory": [
+		{"kind": "tag", "name": "Tier 1", "value": "1", "price": null, "apiLink": "a"},
+		{"kind": "sticker", "name": "Katowice 2014", "value": "7", "price": null, "apiLink": "b"}
+	]}`)
+	var item ProcessedItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		t.Fatalf("item with a category of unknown kind wasn't decoded: %v", err)
+	}
+	if len(item.StyleCategory) != 2 {
+		t.Fatalf("decoded %d style categories, want 2", len(item.StyleCategory))
+	}
+	unknown := item.StyleCategory[1]
+	if unknown.Kind != "sticker" || unknown.Kind.Known() || !item.StyleCategory[0].Kind.Known() {
+		t.Errorf("decoded kinds %q and %q", item.StyleCategory[0].Kind, unknown.Kind)
+	}
+
+	// The category is posted back as the newer producer wrote it
+	encoded, err := json.Marshal(unknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["kind"] != "sticker" || fields["value"] != "7" || fields["parameter"] != nil {
+		t.Errorf("category of unknown kind was encoded as %s", encoded)
+	}
+}
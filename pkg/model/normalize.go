@@ -0,0 +1,32 @@
+package model
+
+import (
+	"buff163Parser/pkg/buyOrders"
+	"buff163Parser/pkg/prices"
+)
+
+// Normalize fills normalized prices of the item, its categories and buy order book
+func (item *ProcessedItem) Normalize(converter *prices.Converter) {
+	item.ListingPriceConverted = converter.ConvertSource(item.ListingPrice)
+	item.BuyOrderPriceConverted = converter.ConvertSource(item.BuyOrderPrice)
+	for _, categories := range item.Categories() {
+		for i := range categories {
+			categories[i].Normalize(converter)
+		}
+	}
+	buyOrders.Normalize(item.BuyOrderBook, converter)
+}
+
+// Normalize fills normalized prices of the category
+func (c *Category) Normalize(converter *prices.Converter) {
+	c.PriceConverted = nil
+	if c.Price != nil {
+		c.PriceConverted = converter.ConvertSource(*c.Price)
+	}
+	c.ListingsPricesConverted = nil
+	for _, price := range c.ListingsPrices {
+		if converted := converter.ConvertSource(price); converted != nil {
+			c.ListingsPricesConverted = append(c.ListingsPricesConverted, *converted)
+		}
+	}
+}
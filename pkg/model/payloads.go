@@ -0,0 +1,83 @@
+package model
+
+import (
+	"buff163Parser/pkg/prices"
+	"encoding/json"
+)
+
+type Sticker struct {
+	Category  string  `json:"category"`
+	ImgURL    string  `json:"img_url"`
+	Name      string  `json:"name"`
+	Slot      int     `json:"slot"`
+	StickerID int     `json:"sticker_id"`
+	Wear      float64 `json:"wear"`
+}
+
+// ResultData is the price history of an item for a window of days, sent to the backend
+type ResultData struct {
+	// SchemaVersion is always written as the current SchemaVersion
+	SchemaVersion      int         `json:"schema_version"`
+	GoodsID            string      `json:"goodsid"`
+	Currency           string      `json:"currency"`
+	CurrencySymbol     string      `json:"currency_symbol"`
+	Days               int         `json:"days"`
+	PriceType          string      `json:"price_type"`
+	SteamPriceCurrency string      `json:"steam_price_currency"`
+	PriceHistory       [][]float64 `json:"price_history"`
+	// NormalizedPriceHistory is PriceHistory with prices in NormalizedCurrency, empty if there is no rate
+	NormalizedCurrency     string      `json:"normalized_currency,omitempty"`
+	NormalizedPriceHistory [][]float64 `json:"normalized_price_history,omitempty"`
+}
+
+type resultDataJSON ResultData
+
+func (r ResultData) MarshalJSON() ([]byte, error) {
+	r.SchemaVersion = SchemaVersion
+	return json.Marshal(resultDataJSON(r))
+}
+
+// ProcessedSaleRecord is a single sale of an item, sent to the backend
+type ProcessedSaleRecord struct {
+	// SchemaVersion is always written as the current SchemaVersion
+	SchemaVersion  int               `json:"schema_version"`
+	Stickers       []Sticker         `json:"stickers"`
+	Price          string            `json:"price"`
+	PriceConverted *prices.Converted `json:"price_converted,omitempty"`
+	GoodsID        int               `json:"goodsid"`
+	SaleID         string            `json:"sale_id"`
+	Date           int64             `json:"date"`
+	Float          string            `json:"floatvalue"`
+	SellerID       string            `json:"seller_id"`
+}
+
+type saleRecordJSON ProcessedSaleRecord
+
+func (r ProcessedSaleRecord) MarshalJSON() ([]byte, error) {
+	r.SchemaVersion = SchemaVersion
+	return json.Marshal(saleRecordJSON(r))
+}
+
+// ProcessedListing is a single sell order found while parsing categories
+type ProcessedListing struct {
+	// SchemaVersion is always written as the current SchemaVersion
+	SchemaVersion  int               `json:"schema_version"`
+	SellOrderID    string            `json:"sell_order_id"`
+	GoodsID        int               `json:"goodsid"`
+	Price          string            `json:"price"`
+	PriceConverted *prices.Converted `json:"price_converted,omitempty"`
+	Float          string            `json:"floatvalue"`
+	PaintSeed      int               `json:"paintseed"`
+	PaintIndex     int               `json:"paintindex"`
+	Stickers       []Sticker         `json:"stickers"`
+	SellerID       string            `json:"seller_id"`
+	// Category is the label of the category the listing was first found in
+	Category string `json:"category"`
+}
+
+type listingJSON ProcessedListing
+
+func (l ProcessedListing) MarshalJSON() ([]byte, error) {
+	l.SchemaVersion = SchemaVersion
+	return json.Marshal(listingJSON(l))
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:generate go run ./gen
+
+// payloads are the JSON documents sent to the backend, by the name of their schema file
+var payloads = map[string]interface{}{
+	"item":          ProcessedItem{},
+	"category":      Category{},
+	"sale_record":   ProcessedSaleRecord{},
+	"price_history": ResultData{},
+	"listing":       ProcessedListing{},
+}
+
+// Schemas returns JSON Schema documents of the payloads of the current SchemaVersion, by payload name
+func Schemas() map[string]*JSONSchema {
+	schemas := make(map[string]*JSONSchema, len(payloads))
+	for name, payload := range payloads {
+		schemas[name] = GenerateJSONSchema(name, payload)
+	}
+	return schemas
+}
+
+// SchemaDir is the directory schema documents of the version are kept in, relative to root
+func SchemaDir(root string, version int) string {
+	return filepath.Join(root, fmt.Sprintf("v%d", version))
+}
+
+func schemaFile(dir, name string) string {
+	return filepath.Join(dir, name+".schema.json")
+}
+
+// EncodeSchema returns the document as it's written to a file
+func EncodeSchema(schema *JSONSchema) ([]byte, error) {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ReadSchemas reads the schema documents of the payloads from dir. Payloads without a document are left out.
+func ReadSchemas(dir string) (map[string]*JSONSchema, error) {
+	schemas := make(map[string]*JSONSchema)
+	for name := range payloads {
+		data, err := os.ReadFile(schemaFile(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var schema JSONSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("error decoding schema of %s: %v", name, err)
+		}
+		schemas[name] = &schema
+	}
+	return schemas, nil
+}
+
+// WriteSchemas writes documents of the current SchemaVersion under root. Documents already written for
+// this version are the compatibility baseline: a change breaking it is refused, it needs a new SchemaVersion.
+func WriteSchemas(root string) error {
+	dir := SchemaDir(root, SchemaVersion)
+	baseline, err := ReadSchemas(dir)
+	if err != nil {
+		return err
+	}
+	current := Schemas()
+	var problems []string
+	for name, schema := range baseline {
+		for _, problem := range CompatibilityProblems(schema, current[name]) {
+			problems = append(problems, name+": "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("payloads are incompatible with schema version %d, bump model.SchemaVersion:\n%s",
+			SchemaVersion, strings.Join(problems, "\n"))
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, schema := range current {
+		data, err := EncodeSchema(schema)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(schemaFile(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
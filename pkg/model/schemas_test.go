@@ -0,0 +1,198 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// baselineRoot is where go generate writes the schema documents, they are committed
+const baselineRoot = "schemas"
+
+func TestSchemasAreBackwardCompatible(t *testing.T) {
+	baseline, err := ReadSchemas(SchemaDir(baselineRoot, SchemaVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := Schemas()
+	for name, schema := range current {
+		baselineSchema, ok := baseline[name]
+		if !ok {
+			t.Errorf("no baseline schema of %s for version %d, run go generate ./pkg/model", name, SchemaVersion)
+			continue
+		}
+		for _, problem := range CompatibilityProblems(baselineSchema, schema) {
+			t.Errorf("%s breaks schema version %d: %s", name, SchemaVersion, problem)
+		}
+	}
+}
+
+func TestSchemasAreUpToDate(t *testing.T) {
+	for name, schema := range Schemas() {
+		want, err := EncodeSchema(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(schemaFile(SchemaDir(baselineRoot, SchemaVersion), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("schema of %s is out of date, run go generate ./pkg/model", name)
+		}
+	}
+}
+
+func TestCompatibilityProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(item *JSONSchema)
+		problem string
+	}{
+		{"unchanged", func(item *JSONSchema) {}, ""},
+		{"added property", func(item *JSONSchema) {
+			item.Properties["rarity"] = &JSONSchema{Type: Types{"string"}}
+		}, ""},
+		{"removed property", func(item *JSONSchema) {
+			delete(item.Properties, "listingprice")
+		}, "$.listingprice: removed"},
+		{"retyped property", func(item *JSONSchema) {
+			item.Properties["listings"] = &JSONSchema{Type: Types{"string"}}
+		}, "$.listings: type changed"},
+		{"nullable property", func(item *JSONSchema) {
+			item.Properties["goodsid"].Type = Types{"string", "null"}
+		}, "$.goodsid: type changed"},
+		{"optional property", func(item *JSONSchema) {
+			item.Required = item.Required[1:]
+		}, "no longer required"},
+		{"added enum value", func(item *JSONSchema) {
+			kind := item.Properties["stylecategory"].Items.Properties["kind"]
+			kind.Enum = append(kind.Enum, "sticker")
+		}, `$.stylecategory[].kind: enum value "sticker" added`},
+		{"removed enum value", func(item *JSONSchema) {
+			game := item.Properties["game"]
+			game.Enum = game.Enum[1:]
+		}, "$.game: enum value"},
+		{"dropped enum", func(item *JSONSchema) {
+			item.Properties["game"].Enum = nil
+		}, "$.game: enum [csgo dota2 rust tf2] is no longer enforced"},
+		{"nested property", func(item *JSONSchema) {
+			delete(item.Properties["floatcategory"].Items.Properties, "apiLink")
+		}, "$.floatcategory[].apiLink: removed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baseline := GenerateJSONSchema("item", ProcessedItem{})
+			current := GenerateJSONSchema("item", ProcessedItem{})
+			test.change(current)
+			problems := CompatibilityProblems(baseline, current)
+			if test.problem == "" {
+				if len(problems) > 0 {
+					t.Errorf("compatible change reported as %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0], test.problem) {
+				t.Errorf("got problems %v, want one with %q", problems, test.problem)
+			}
+		})
+	}
+}
+
+// validate checks a decoded JSON value against the subset of JSON Schema GenerateJSONSchema writes
+func validate(path string, schema *JSONSchema, value interface{}) error {
+	typ := "null"
+	switch value.(type) {
+	case string:
+		typ = "string"
+	case bool:
+		typ = "boolean"
+	case float64:
+		typ = "number"
+	case []interface{}:
+		typ = "array"
+	case map[string]interface{}:
+		typ = "object"
+	}
+	if len(schema.Type) > 0 && !schema.Type.contains(typ) &&
+		!(typ == "number" && schema.Type.contains("integer") && value.(float64) == float64(int64(value.(float64)))) {
+		return fmt.Errorf("%s: %s isn't %v", path, typ, []string(schema.Type))
+	}
+
+	switch value := value.(type) {
+	case []interface{}:
+		for i, item := range value {
+			if err := validate(fmt.Sprintf("%s[%d]", path, i), schema.Items, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				return fmt.Errorf("%s.%s: missing", path, name)
+			}
+		}
+		for name, property := range value {
+			propertySchema, ok := schema.Properties[name]
+			if !ok {
+				return fmt.Errorf("%s.%s: not in the schema", path, name)
+			}
+			if err := validate(path+"."+name, propertySchema, property); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestPayloadsMatchSchemas(t *testing.T) {
+	item := fullItem(t)
+	price := "1205.5"
+	samples := map[string]interface{}{
+		"item":     item,
+		"category": item.StyleCategory[1],
+		"sale_record": ProcessedSaleRecord{
+			Stickers:       []Sticker{{Category: "sticker", Name: "Titan (Holo) | Katowice 2014", Slot: 1, StickerID: 5, Wear: 0.1}},
+			Price:          price,
+			PriceConverted: converted(t, price),
+			GoodsID:        35213,
+			SaleID:         "sale-1",
+			Date:           1700000000,
+			Float:          "0.0061",
+			SellerID:       "U1",
+		},
+		"price_history": ResultData{
+			GoodsID:                "35213",
+			Currency:               "USD",
+			Days:                   7,
+			PriceType:              "2",
+			PriceHistory:           [][]float64{{1700000000000, 172.5}},
+			NormalizedCurrency:     "USD",
+			NormalizedPriceHistory: [][]float64{{1700000000000, 172.5}},
+		},
+		"listing": ProcessedListing{SellOrderID: "order-1", GoodsID: 35213, Price: price, PriceConverted: converted(t, price)},
+		// Zero values write nulls for slices and pointers without omitempty
+		"empty item": ProcessedItem{},
+	}
+	schemas := Schemas()
+	for name, sample := range samples {
+		data, err := json.Marshal(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded["schema_version"] != nil && decoded["schema_version"] != float64(SchemaVersion) {
+			t.Errorf("%s was written with schema_version %v", name, decoded["schema_version"])
+		}
+		schema := schemas[strings.TrimPrefix(name, "empty ")]
+		if err := validate("$", schema, decoded); err != nil {
+			t.Errorf("%s doesn't match its schema: %v", name, err)
+		}
+	}
+}
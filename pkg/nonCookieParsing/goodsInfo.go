@@ -0,0 +1,139 @@
+package nonCookieParsing
+
+import (
+	"buff163Parser/pkg/schemaDrift"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ParseError is returned when a goods/info response doesn't match the expected schema.
+// Path is the dotted path of the failing field, e.g. data.asset_tags.items.id, empty if the body isn't JSON at all.
+type ParseError struct {
+	Path string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("error parsing goods info: %v", e.Err)
+	}
+	return fmt.Sprintf("error parsing goods info field %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// stringAt reads a JSON string or number, buff163 is not consistent about them. Missing and null values are empty.
+// Errors are *ParseError naming path.
+func stringAt(raw json.RawMessage, path string) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", &ParseError{Path: path, Err: err}
+		}
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(string(raw), 64); err != nil {
+		return "", &ParseError{Path: path, Err: fmt.Errorf("expected string or number, got %s", raw)}
+	}
+	return string(raw), nil
+}
+
+// intAt reads a JSON number or numeric string. Missing and null values are zero. Errors are *ParseError naming path.
+func intAt(raw json.RawMessage, path string) (int, error) {
+	value, err := stringAt(raw, path)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, &ParseError{Path: path, Err: fmt.Errorf("expected number, got %q", value)}
+	}
+	return int(parsed), nil
+}
+
+// goodsInfoSchema is the expected shape of a goods/info response. Only the fields the parser reads are described.
+var goodsInfoSchema = schemaDrift.Object(schemaDrift.Fields{
+	"code": schemaDrift.Required(schemaDrift.String()),
+	"msg":  schemaDrift.Any(),
+	"data": schemaDrift.Required(schemaDrift.Object(schemaDrift.Fields{
+		"market_hash_name":  schemaDrift.Required(schemaDrift.String()),
+		"sell_min_price":    schemaDrift.Required(schemaDrift.Scalar()),
+		"sell_num":          schemaDrift.Required(schemaDrift.Scalar()),
+		"buy_num":           schemaDrift.Required(schemaDrift.Scalar()),
+		"buy_max_price":     schemaDrift.Required(schemaDrift.Scalar()),
+		"steam_market_url":  schemaDrift.String(),
+		"has_fade_name":     schemaDrift.Bool(),
+		"paintwear_choices": schemaDrift.Array(schemaDrift.Array(schemaDrift.Scalar())),
+		"fade_choices":      schemaDrift.Array(schemaDrift.Array(schemaDrift.Scalar())),
+		"asset_tags": schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+			"items": schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+				"id":   schemaDrift.Required(schemaDrift.Scalar()),
+				"name": schemaDrift.String(),
+			})),
+		})),
+		"paintseed_filters": schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+			"type": schemaDrift.String(),
+			"items": schemaDrift.Array(schemaDrift.Object(schemaDrift.Fields{
+				"name":  schemaDrift.Scalar(),
+				"value": schemaDrift.Scalar(),
+			})),
+		})),
+	})),
+})
+
+type GoodsInfoResponse struct {
+	Code string     `json:"code"`
+	Data *GoodsInfo `json:"data"`
+}
+
+// GoodsInfo is the data of a goods/info response. Every field is optional, missing ones stay zero.
+type GoodsInfo struct {
+	MarketHashName   string              `json:"market_hash_name"`
+	SellMinPrice     json.RawMessage     `json:"sell_min_price"`
+	SellNum          json.RawMessage     `json:"sell_num"`
+	BuyNum           json.RawMessage     `json:"buy_num"`
+	BuyMaxPrice      json.RawMessage     `json:"buy_max_price"`
+	SteamMarketURL   string              `json:"steam_market_url"`
+	HasFadeName      bool                `json:"has_fade_name"`
+	PaintwearChoices [][]json.RawMessage `json:"paintwear_choices"`
+	FadeChoices      [][]json.RawMessage `json:"fade_choices"`
+	AssetTags        []AssetTagGroup     `json:"asset_tags"`
+	PaintseedFilters []PaintseedFilter   `json:"paintseed_filters"`
+}
+
+type AssetTagGroup struct {
+	Items []struct {
+		ID   json.RawMessage `json:"id"`
+		Name string          `json:"name"`
+	} `json:"items"`
+}
+
+type PaintseedFilter struct {
+	Type  string `json:"type"`
+	Items []struct {
+		Name  json.RawMessage `json:"name"`
+		Value json.RawMessage `json:"value"`
+	} `json:"items"`
+}
+
+// decodeGoodsInfo decodes a goods/info response body. Errors are *ParseError.
+func decodeGoodsInfo(body []byte) (*GoodsInfoResponse, error) {
+	var response GoodsInfoResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &ParseError{Path: typeErr.Field, Err: fmt.Errorf("cannot decode %s as %s", typeErr.Value, typeErr.Type)}
+		}
+		return nil, &ParseError{Err: err}
+	}
+	return &response, nil
+}
@@ -0,0 +1,160 @@
+package nonCookieParsing
+
+import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/buyOrders"
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/nonCookieParsing/utils"
+	"context"
+	"github.com/sirupsen/logrus"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// poolHealthInterval is how often the proxy pool health is logged while the pipeline runs
+const poolHealthInterval = time.Minute
+
+// runPipeline parses ids through the proxy pool and uploads the results. Long-lived workers take IDs
+// from a shared channel and a proxy from the pool for each of them, so a slow proxy only delays its own items.
+// Fetched items go through a results channel to a single uploader. It returns the number of uploaded items
+// once all ids are processed or ctx is done. Requests in flight use workCtx.
+// If buy orders are enabled, the buy order book of each fetched item is requested through another proxy.
+func (p *nonCookieParser) runPipeline(ctx, workCtx context.Context, ids []backend.WorkItem, workers int) int {
+	idsCh := make(chan backend.WorkItem)
+	results := make(chan *model.ProcessedItem, workers)
+
+	go func() {
+		defer close(idsCh)
+		for _, id := range ids {
+			select {
+			case idsCh <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var workersWg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			for workItem := range idsCh {
+				item, ok := p.processItem(workCtx, workItem)
+				if !ok {
+					return
+				}
+				if item != nil {
+					results <- item
+				}
+			}
+		}()
+	}
+
+	go func() {
+		workersWg.Wait()
+		close(results)
+	}()
+
+	healthCtx, stopHealthLogging := context.WithCancel(ctx)
+	defer stopHealthLogging()
+	go func() {
+		ticker := time.NewTicker(poolHealthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logPoolHealth(p.proxyPool)
+			case <-healthCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return uploadItems(workCtx, p.backendClient, results)
+}
+
+// processItem fetches the item through a proxy of the pool, along with its buy orders if they're enabled.
+// It returns nil if the item is skipped and false once workCtx is done. A panic is recovered and logged,
+// so a single unexpected item is skipped instead of taking the process down.
+func (p *nonCookieParser) processItem(workCtx context.Context, workItem backend.WorkItem) (item *model.ProcessedItem, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			nonCookieParsingLogger.Errorf("Skipping goodsId %s after a panic: %v\n%s", workItem.GoodsID, r, debug.Stack())
+			item, ok = nil, true
+		}
+	}()
+
+	proxy, err := p.proxyPool.Acquire(workCtx)
+	if err != nil {
+		return nil, false
+	}
+	start := time.Now()
+	item, outcome := p.fetchItem(workCtx, proxy, workItem)
+	// Requests aborted on shutdown say nothing about the proxy
+	if workCtx.Err() == nil {
+		p.proxyPool.Report(proxy, outcome, time.Since(start))
+	}
+	if item == nil {
+		return nil, true
+	}
+	if p.config.BuyOrders {
+		item.BuyOrderBook = p.fetchBuyOrdersThroughPool(workCtx, workItem)
+	}
+	item.Normalize(p.converter)
+	return item, true
+}
+
+// fetchBuyOrdersThroughPool takes a proxy from the pool for the buy order request of the item.
+// The item is still uploaded without the book if it can't be fetched.
+func (p *nonCookieParser) fetchBuyOrdersThroughPool(workCtx context.Context, workItem backend.WorkItem) []buyOrders.BuyOrder {
+	proxy, err := p.proxyPool.Acquire(workCtx)
+	if err != nil {
+		return nil
+	}
+	start := time.Now()
+	book, outcome := p.fetchBuyOrders(workCtx, proxy, workItem)
+	if workCtx.Err() == nil {
+		p.proxyPool.Report(proxy, outcome, time.Since(start))
+	}
+	return book
+}
+
+// uploadItems sends items to the backend until results is closed
+func uploadItems(ctx context.Context, backendClient *backend.Client, results <-chan *model.ProcessedItem) int {
+	const N = 100 //TODO move to config. Number of items to notify if they were parsed
+	uploaded := 0
+	for item := range results {
+		// Send the processed item to the backend without using a proxy.
+		if err := backendClient.PostItem(ctx, item); err != nil {
+			nonCookieParsingLogger.WithError(err).Error("Error sending processed item")
+			continue
+		}
+		uploaded++
+		if uploaded%N == 0 {
+			nonCookieParsingLogger.Infof("%d buffIds have been processed", uploaded)
+		}
+	}
+	return uploaded
+}
+
+func logPoolHealth(proxyPool *utils.ProxyPool) {
+	health := proxyPool.Snapshot()
+	nonCookieParsingLogger.WithFields(logrus.Fields{
+		"total":       health.Total,
+		"healthy":     health.Healthy,
+		"quarantined": health.Quarantined,
+	}).Info("Proxy pool health")
+	for _, stats := range health.Proxies {
+		nonCookieParsingLogger.WithFields(logrus.Fields{
+			"proxy":           stats.Proxy,
+			"successes":       stats.Successes,
+			"errors":          stats.Errors,
+			"timeouts":        stats.Timeouts,
+			"tooManyRequests": stats.TooManyRequests,
+			"avgLatency":      stats.AvgLatency,
+			"score":           stats.Score,
+		}).Debug("Proxy health")
+	}
+}
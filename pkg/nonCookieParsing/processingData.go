@@ -1,129 +1,140 @@
 package nonCookieParsing
 
 import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/games"
+	"buff163Parser/pkg/model"
+	"encoding/json"
 	"fmt"
-	"strconv"
 )
 
-func convertToString(val interface{}) string {
-	switch v := val.(type) {
-	case float64:
-		return fmt.Sprintf("%.0f", v)
-	case string:
-		return v
-	default:
-		return "" // or return some default value
-	}
-}
-
 func pointerToString(s string) *string {
 	return &s
 }
 
-func pointerToInt(i int) *int {
-	return &i
+// rangeCategories builds categories of [min, max] choices, choices of other length are skipped
+func rangeCategories(choices [][]json.RawMessage, kind model.CategoryKind, path, apiUrl, minParameter, maxParameter string) ([]model.Category, error) {
+	var categories []model.Category
+	for i, choice := range choices {
+		if len(choice) != 2 {
+			continue
+		}
+		min, err := stringAt(choice[0], fmt.Sprintf("%s[%d][0]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		max, err := stringAt(choice[1], fmt.Sprintf("%s[%d][1]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, model.Category{
+			Kind:    kind,
+			Range:   []string{min, max},
+			ApiLink: apiUrl + "&" + minParameter + "=" + min + "&" + maxParameter + "=" + max,
+		})
+	}
+	return categories, nil
 }
 
-func extractCategories(data map[string]interface{}, apiUrl string) (floatCategory, fadeCategory, styleCategory, paintSeedCategory []Category) {
+// extractCategories builds categories of the item. Float and fade exist only for games with paintwear (CS:GO),
+// tags and filter groups are extracted for every game: Dota 2 gem and style filters come in the same
+// type/items groups as CS:GO pattern filters.
+func extractCategories(data *GoodsInfo, game games.Game, apiUrl string) (floatCategory, fadeCategory, styleCategory, paintSeedCategory []model.Category, err error) {
 
-	// Extracting paintwear_choices
-	if paintwearChoices, ok := data["paintwear_choices"].([]interface{}); ok {
-		for _, item := range paintwearChoices {
-			if choice, ok := item.([]interface{}); ok && len(choice) == 2 {
-				cat := Category{
-					Range:   []string{choice[0].(string), choice[1].(string)},
-					ApiLink: apiUrl + "&min_paintwear=" + choice[0].(string) + "&max_paintwear=" + choice[1].(string),
-				}
-				floatCategory = append(floatCategory, cat)
-			}
+	if game.HasPaintwear() {
+		// Extracting paintwear_choices
+		floatCategory, err = rangeCategories(data.PaintwearChoices, model.KindFloat, "data.paintwear_choices", apiUrl, "min_paintwear", "max_paintwear")
+		if err != nil {
+			return
 		}
-	}
 
-	// Extracting fade_choices
-	if data["has_fade_name"] == true {
-		if fadeChoices, ok := data["fade_choices"].([]interface{}); ok {
-			for _, item := range fadeChoices {
-				if choice, ok := item.([]interface{}); ok && len(choice) == 2 {
-					cat := Category{
-						Range:   []string{choice[0].(string), choice[1].(string)},
-						ApiLink: apiUrl + "&min_fade=" + choice[0].(string) + "&max_fade=" + choice[1].(string),
-					}
-					fadeCategory = append(fadeCategory, cat)
-				}
+		// Extracting fade_choices
+		if data.HasFadeName {
+			fadeCategory, err = rangeCategories(data.FadeChoices, model.KindFade, "data.fade_choices", apiUrl, "min_fade", "max_fade")
+			if err != nil {
+				return
 			}
 		}
 	}
 
 	// Extracting asset_tags
-	if assetTags, ok := data["asset_tags"].([]interface{}); ok && len(assetTags) > 0 {
-		if tags, ok := assetTags[0].(map[string]interface{}); ok {
-			if items, ok := tags["items"].([]interface{}); ok {
-				for _, item := range items {
-					if tagItem, ok := item.(map[string]interface{}); ok {
-						cat := Category{
-							Name:      pointerToString(tagItem["name"].(string)),
-							Value:     pointerToString(fmt.Sprintf("%.0f", tagItem["id"].(float64))),
-							Parameter: pointerToString("tag_ids"),
-							ApiLink:   apiUrl + "&tag_ids=" + strconv.Itoa(int(tagItem["id"].(float64))),
-						}
-						styleCategory = append(styleCategory, cat)
-					}
-				}
+	if len(data.AssetTags) > 0 {
+		for i, tagItem := range data.AssetTags[0].Items {
+			var id string
+			id, err = stringAt(tagItem.ID, fmt.Sprintf("data.asset_tags[0].items[%d].id", i))
+			if err != nil {
+				return
+			}
+			cat := model.Category{
+				Kind:    model.KindTag,
+				Name:    pointerToString(tagItem.Name),
+				Value:   pointerToString(id),
+				ApiLink: apiUrl + "&tag_ids=" + id,
 			}
+			styleCategory = append(styleCategory, cat)
 		}
 	}
 
 	// Extracting paintseed_filters
-	if paintseedFilters, ok := data["paintseed_filters"].([]interface{}); ok {
-		for _, filter := range paintseedFilters {
-			if filterMap, ok := filter.(map[string]interface{}); ok {
-				if filterMap["type"] != "paintseed" && filterMap["items"] != nil {
-					items := filterMap["items"].([]interface{})
-					for _, item := range items {
-						if itemMap, ok := item.(map[string]interface{}); ok {
-							cat := Category{
-								Name:      pointerToString(convertToString(itemMap["name"])),
-								Value:     pointerToString(convertToString(itemMap["value"])),
-								Parameter: pointerToString(filterMap["type"].(string)),
-								ApiLink:   apiUrl + "&" + convertToString(filterMap["type"]) + "=" + convertToString(itemMap["value"]),
-							}
-							paintSeedCategory = append(paintSeedCategory, cat)
-						}
-					}
-				}
+	for i, filter := range data.PaintseedFilters {
+		if filter.Type == "paintseed" {
+			continue
+		}
+		for j, item := range filter.Items {
+			path := fmt.Sprintf("data.paintseed_filters[%d].items[%d]", i, j)
+			var name, value string
+			if name, err = stringAt(item.Name, path+".name"); err != nil {
+				return
+			}
+			if value, err = stringAt(item.Value, path+".value"); err != nil {
+				return
+			}
+			cat := model.Category{
+				Kind:    model.KindFilter,
+				Name:    pointerToString(name),
+				Value:   pointerToString(value),
+				Filter:  filter.Type,
+				ApiLink: apiUrl + "&" + filter.Type + "=" + value,
 			}
+			paintSeedCategory = append(paintSeedCategory, cat)
 		}
 	}
 
 	return
 }
 
-func transformData(id string, responseData map[string]interface{}) *ProcessedItem {
-	// Extracting data field from response
-	data, ok := responseData["data"].(map[string]interface{})
-	if !ok {
-		nonCookieParsingLogger.Error("Error processing response data.")
-		return nil
-	}
-
-	apiUrl := fmt.Sprintf("https://buff.163.com/api/market/goods/sell_order?game=csgo&goods_id=%s&page_num=1&sort_by=default&mode=&allow_tradable_cooldown=1", id) // You might need to define your API URL here
+// transformData builds the item from goods info. Fields of unexpected type are returned as *ParseError.
+func transformData(workItem backend.WorkItem, data *GoodsInfo, apiUrl string) (*model.ProcessedItem, error) {
+	id := workItem.GoodsID
 
 	// Extracting categories
-	floatCategory, fadeCategory, styleCategory, paintSeedCategory := extractCategories(data, apiUrl)
+	floatCategory, fadeCategory, styleCategory, paintSeedCategory, err := extractCategories(data, workItem.Game, apiUrl)
+	if err != nil {
+		return nil, err
+	}
 
 	// Extracting and transforming required fields
-	item := &ProcessedItem{
+	item := &model.ProcessedItem{
 		GoodsID:         id,
-		MarketHashName:  data["market_hash_name"].(string),
-		ListingPrice:    data["sell_min_price"].(string),
-		Listings:        int(data["sell_num"].(float64)), // JSON numbers are float64 by default in Go
-		BuyOrders:       int(data["buy_num"].(float64)),
-		BuyOrderPrice:   data["buy_max_price"].(string),
-		SteamMarketLink: data["steam_market_url"].(string),
+		Game:            workItem.Game,
+		MarketHashName:  data.MarketHashName,
+		SteamMarketLink: data.SteamMarketURL,
 		FadeCategory:    fadeCategory,
 		StyleCategory:   append(styleCategory, paintSeedCategory...), // Merging two slices here
 		FloatCategory:   floatCategory,
 	}
+	if item.ListingPrice, err = stringAt(data.SellMinPrice, "data.sell_min_price"); err != nil {
+		return nil, err
+	}
+	if item.Listings, err = intAt(data.SellNum, "data.sell_num"); err != nil {
+		return nil, err
+	}
+	if item.BuyOrders, err = intAt(data.BuyNum, "data.buy_num"); err != nil {
+		return nil, err
+	}
+	if item.BuyOrderPrice, err = stringAt(data.BuyMaxPrice, "data.buy_max_price"); err != nil {
+		return nil, err
+	}
 
-	return item
+	return item, nil
 }
@@ -1,47 +1,42 @@
 package utils
 
 import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/proxyDialer"
+	"context"
 	"errors"
-	"net/http"
+	"fmt"
 	"net/url"
-	"sync/atomic"
 )
 
-var proxies []string
-var proxyIndex int32 = -1
-
-func InitProxies(jwtToken string) (int, error) {
-	var err error
-	proxies, err = fetchParsingProxies(jwtToken)
+// InitProxies fetches parsing proxies from the backend and validates them.
+// Invalid proxies are skipped and reported in the returned error along with the valid ones.
+func InitProxies(ctx context.Context, backendClient *backend.Client) ([]*url.URL, error) {
+	proxies, err := backendClient.ParsingProxies(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if len(proxies) == 0 {
-		return 0, errors.New("no proxies returned from fetch")
+		return nil, errors.New("no proxies returned from fetch")
 	}
 
-	// Reset index
-	proxyIndex = -1
-
-	return len(proxies), nil
-}
-func GetNextProxy() (*url.URL, error) {
-	nextIndex := atomic.AddInt32(&proxyIndex, 1) % int32(len(proxies))
-	return url.Parse(proxies[nextIndex])
-}
-
-func GetHttpClientWithProxy() (*http.Client, error) {
-	proxyURL, err := GetNextProxy()
-	if err != nil {
-		return nil, err
+	proxyURLs := make([]*url.URL, 0, len(proxies))
+	var invalid []error
+	for i, proxy := range proxies {
+		proxyURL, err := proxyDialer.Parse(proxy)
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("proxy #%d: %w", i, err))
+			continue
+		}
+		proxyURLs = append(proxyURLs, proxyURL)
 	}
 
-	transport := &http.Transport{
-		Proxy: http.ProxyURL(proxyURL),
+	if len(proxyURLs) == 0 {
+		return nil, fmt.Errorf("no valid proxies returned from fetch: %w", errors.Join(invalid...))
 	}
-
-	return &http.Client{
-		Transport: transport,
-	}, nil
+	if len(invalid) > 0 {
+		return proxyURLs, fmt.Errorf("%d invalid proxies skipped: %w", len(invalid), errors.Join(invalid...))
+	}
+	return proxyURLs, nil
 }
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"buff163Parser/pkg/proxyDialer"
+	"buff163Parser/pkg/shutdown"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of a request made through a proxy
+type Outcome int
+
+const (
+	OutcomeSuccess Outcome = iota
+	OutcomeError
+	OutcomeTimeout
+	OutcomeTooManyRequests
+)
+
+// latencySmoothing is the weight of the newest sample in the moving average of latency
+const latencySmoothing = 0.2
+
+// maxAcquireWait bounds a single wait in Acquire, so proxies added by SetProxies are noticed quickly
+const maxAcquireWait = time.Second
+
+// ProxyPoolSettings tunes pacing and quarantine of a ProxyPool
+type ProxyPoolSettings struct {
+	// Delay is the minimal delay between two requests through the same proxy
+	Delay time.Duration
+	// FailureThreshold is the number of consecutive failures that puts a proxy into quarantine
+	FailureThreshold int
+	// QuarantineBase is the first cool-down, every next quarantine in a row doubles it
+	QuarantineBase time.Duration
+	// QuarantineMax caps the cool-down
+	QuarantineMax time.Duration
+	// Timeouts of the clients created for the proxies
+	Timeouts proxyDialer.Timeouts
+	// WrapTransport, if set, wraps the transport of every client created for a proxy
+	WrapTransport func(proxied http.RoundTripper) http.RoundTripper
+}
+
+// Proxy is a proxy of the pool along with the HTTP client that sends requests through it
+type Proxy struct {
+	URL    *url.URL
+	Client *http.Client
+
+	successes           int
+	errors              int
+	timeouts            int
+	tooManyRequests     int
+	avgLatency          time.Duration
+	consecutiveFailures int
+	quarantines         int // quarantines in a row, reset by a success
+	quarantinedUntil    time.Time
+	nextAllowed         time.Time
+}
+
+// score is the selection weight of the proxy. It favours proxies with high success rate and low latency.
+func (p *Proxy) score() float64 {
+	total := p.successes + p.errors + p.timeouts + p.tooManyRequests
+	// Laplace smoothing, so new proxies get a fair chance
+	successRate := float64(p.successes+1) / float64(total+2)
+	return successRate * successRate / (1 + p.avgLatency.Seconds())
+}
+
+// ProxyStats is a snapshot of the health of a single proxy
+type ProxyStats struct {
+	Proxy            string
+	Successes        int
+	Errors           int
+	Timeouts         int
+	TooManyRequests  int
+	AvgLatency       time.Duration
+	Score            float64
+	QuarantinedUntil time.Time
+}
+
+// PoolHealth is a snapshot of the health of the whole pool
+type PoolHealth struct {
+	Total       int
+	Healthy     int
+	Quarantined int
+	Proxies     []ProxyStats
+}
+
+// ProxyPool hands out proxies by weighted score, paces requests per proxy and quarantines failing proxies
+// with exponential cool-down. It's safe for concurrent use, including SetProxies while workers acquire proxies.
+type ProxyPool struct {
+	settings ProxyPoolSettings
+
+	mu      sync.Mutex
+	proxies map[string]*Proxy
+}
+
+func NewProxyPool(settings ProxyPoolSettings) *ProxyPool {
+	return &ProxyPool{settings: settings, proxies: make(map[string]*Proxy)}
+}
+
+// SetProxies replaces the proxies of the pool. Proxies that stay in the pool keep their stats and clients.
+// Proxies a client can't be created for are left out and reported in the returned error.
+func (p *ProxyPool) SetProxies(proxyURLs []*url.URL) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	proxies := make(map[string]*Proxy, len(proxyURLs))
+	for _, proxyURL := range proxyURLs {
+		key := proxyURL.String()
+		if existing, ok := p.proxies[key]; ok {
+			proxies[key] = existing
+			continue
+		}
+		client, err := proxyDialer.NewClient(proxyURL, p.settings.Timeouts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy %s: %w", proxyDialer.Address(proxyURL), err))
+			continue
+		}
+		if p.settings.WrapTransport != nil {
+			client.Transport = p.settings.WrapTransport(client.Transport)
+		}
+		proxies[key] = &Proxy{URL: proxyURL, Client: client}
+	}
+	p.proxies = proxies
+	return errors.Join(errs...)
+}
+
+// Acquire returns a proxy that may be used right now, chosen randomly weighted by score.
+// It waits while all proxies are quarantined or paced and returns ctx error if ctx is done first.
+func (p *ProxyPool) Acquire(ctx context.Context) (*Proxy, error) {
+	for {
+		proxy, wait := p.tryAcquire(time.Now())
+		if proxy != nil {
+			return proxy, nil
+		}
+		if !shutdown.Sleep(ctx, wait) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryAcquire picks an available proxy, or returns how long to wait for one
+func (p *ProxyPool) tryAcquire(now time.Time) (*Proxy, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var candidates []*Proxy
+	var totalScore float64
+	wait := maxAcquireWait
+	for _, proxy := range p.proxies {
+		availableAt := proxy.nextAllowed
+		if proxy.quarantinedUntil.After(availableAt) {
+			availableAt = proxy.quarantinedUntil
+		}
+		if availableAt.After(now) {
+			if untilAvailable := availableAt.Sub(now); untilAvailable < wait {
+				wait = untilAvailable
+			}
+			continue
+		}
+		candidates = append(candidates, proxy)
+		totalScore += proxy.score()
+	}
+	if len(candidates) == 0 {
+		return nil, wait
+	}
+
+	chosen := candidates[len(candidates)-1]
+	pick := rand.Float64() * totalScore
+	for _, proxy := range candidates {
+		pick -= proxy.score()
+		if pick <= 0 {
+			chosen = proxy
+			break
+		}
+	}
+	chosen.nextAllowed = now.Add(p.settings.Delay)
+	return chosen, 0
+}
+
+// Report records the outcome of a request made through the proxy
+func (p *ProxyPool) Report(proxy *Proxy, outcome Outcome, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if proxy.avgLatency == 0 {
+		proxy.avgLatency = latency
+	} else {
+		proxy.avgLatency = time.Duration((1-latencySmoothing)*float64(proxy.avgLatency) + latencySmoothing*float64(latency))
+	}
+
+	switch outcome {
+	case OutcomeSuccess:
+		proxy.successes++
+		proxy.consecutiveFailures = 0
+		proxy.quarantines = 0
+		return
+	case OutcomeTimeout:
+		proxy.timeouts++
+	case OutcomeTooManyRequests:
+		proxy.tooManyRequests++
+	default:
+		proxy.errors++
+	}
+
+	proxy.consecutiveFailures++
+	if proxy.consecutiveFailures < p.settings.FailureThreshold {
+		return
+	}
+
+	cooldown := p.settings.QuarantineBase << proxy.quarantines
+	if cooldown <= 0 || cooldown > p.settings.QuarantineMax {
+		cooldown = p.settings.QuarantineMax
+	} else {
+		proxy.quarantines++
+	}
+	proxy.consecutiveFailures = 0
+	proxy.quarantinedUntil = time.Now().Add(cooldown)
+}
+
+// Snapshot returns the health of the pool for logging
+func (p *ProxyPool) Snapshot() PoolHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	health := PoolHealth{Total: len(p.proxies)}
+	for _, proxy := range p.proxies {
+		if proxy.quarantinedUntil.After(now) {
+			health.Quarantined++
+		} else {
+			health.Healthy++
+		}
+		health.Proxies = append(health.Proxies, ProxyStats{
+			Proxy:            proxyDialer.Address(proxy.URL),
+			Successes:        proxy.successes,
+			Errors:           proxy.errors,
+			Timeouts:         proxy.timeouts,
+			TooManyRequests:  proxy.tooManyRequests,
+			AvgLatency:       proxy.avgLatency,
+			Score:            proxy.score(),
+			QuarantinedUntil: proxy.quarantinedUntil,
+		})
+	}
+	return health
+}
@@ -1,36 +1,38 @@
 package nonCookieParsing
 
 import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/buyOrders"
+	"buff163Parser/pkg/configManager"
 	"buff163Parser/pkg/logger"
+	"buff163Parser/pkg/model"
 	"buff163Parser/pkg/nonCookieParsing/utils"
-	"bytes"
-	"encoding/json"
+	"buff163Parser/pkg/prices"
+	"buff163Parser/pkg/proxyDialer"
+	"buff163Parser/pkg/schemaDrift"
+	"buff163Parser/pkg/shutdown"
+	"buff163Parser/pkg/upstream"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
-	"sync"
 	"time"
 )
 
 // TODO put this logger in other packages
 var nonCookieParsingLogger = logger.Log.WithField("context", "nonCookieParsing")
 
-func processAndSendItem(jwtToken, id string) {
-	// Use proxy to make a request to the third-party API
-	clientWithProxy, err := utils.GetHttpClientWithProxy()
-	if err != nil {
-		nonCookieParsingLogger.WithError(err).Error("Error getting HTTP client with proxy")
-		return
-	}
-
-	thirdPartyURL := fmt.Sprintf("https://buff.163.com/api/market/goods/info?goods_id=%s&game=csgo", id)
-
+// fetchBody makes a request to buff163 through the proxy client and returns the body on 200.
+// The outcome tells how the proxy behaved, so it can be reported to the proxy pool.
+func fetchBody(ctx context.Context, clientWithProxy *http.Client, apiLink, id string) ([]byte, utils.Outcome) {
 	// Create a new request
-	req1, err := http.NewRequest("GET", thirdPartyURL, nil)
+	req1, err := http.NewRequestWithContext(ctx, "GET", apiLink, nil)
 	if err != nil {
 		nonCookieParsingLogger.WithError(err).Error("Error creating new request")
-		return
+		return nil, utils.OutcomeError
 	}
 
 	// Set the Accept-Language header for the request
@@ -40,79 +42,164 @@ func processAndSendItem(jwtToken, id string) {
 	resp, err := clientWithProxy.Do(req1)
 	if err != nil {
 		nonCookieParsingLogger.WithError(err).Error("Error making request to third-party API")
-		return
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, utils.OutcomeTimeout
+		}
+		return nil, utils.OutcomeError
 	}
 	defer resp.Body.Close()
 
-	// Here you can process the response from the third-party API if needed
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		nonCookieParsingLogger.Errorf("Received %d for goodsId %s", resp.StatusCode, id)
+		return nil, utils.OutcomeTooManyRequests
+	default:
+		nonCookieParsingLogger.Errorf("Received unexpected status %d for goodsId %s", resp.StatusCode, id)
+		return nil, utils.OutcomeError
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		nonCookieParsingLogger.WithError(err).Error("Error reading response body")
-		return
+		return nil, utils.OutcomeError
 	}
+	return body, utils.OutcomeSuccess
+}
+
+// nonCookieParser holds what the pipeline workers share
+type nonCookieParser struct {
+	backendClient *backend.Client
+	proxyPool     *utils.ProxyPool
+	drift         *schemaDrift.Detector
+	converter     *prices.Converter
+	config        *configManager.NonCookieParsingConfig
+	buff          *upstream.Buff
+}
 
-	// Assuming the response structure corresponds to the JSON you provided
-	var responseData map[string]interface{}
-	if err := json.Unmarshal(body, &responseData); err != nil {
-		nonCookieParsingLogger.WithError(err).Error("Error unmarshalling response")
-		return
+// checkSchema checks the response against the schema of the endpoint, drifted responses are quarantined.
+// It returns the outcome to report and false if the response must not be used, the problem is logged.
+func (p *nonCookieParser) checkSchema(endpoint string, schema *schemaDrift.Schema, body []byte, proxy *utils.Proxy, id string) (utils.Outcome, bool) {
+	metadata := schemaDrift.Metadata{GoodsID: id, Proxy: proxy.URL.String()}
+	err := p.drift.Check(endpoint, schema, body, metadata)
+	if err == nil {
+		return utils.OutcomeSuccess, true
 	}
-	if code, exists := responseData["code"].(string); !exists || code != "OK" {
-		nonCookieParsingLogger.Error("Invalid response or response code is not 'OK'")
-		return
+	nonCookieParsingLogger.WithError(err).Errorf("Unexpected %s response for goodsId %s", endpoint, id)
+	// A body that isn't JSON usually comes from the proxy, a drifted one from Buff
+	var driftErr *schemaDrift.DriftError
+	if errors.As(err, &driftErr) && !driftErr.NotJSON {
+		return utils.OutcomeSuccess, false
 	}
+	return utils.OutcomeError, false
+}
 
-	// Here you can process the response from the third-party API
-	_, ok := responseData["data"].(map[string]interface{})
-	if !ok {
-		nonCookieParsingLogger.Error("Error processing response data")
-		return
+// fetchItem gets goods info of the item through the proxy and transforms it.
+// It returns nil if the item couldn't be fetched, the error is logged.
+// The outcome tells how the proxy behaved, so it can be reported to the proxy pool.
+func (p *nonCookieParser) fetchItem(ctx context.Context, proxy *utils.Proxy, workItem backend.WorkItem) (*model.ProcessedItem, utils.Outcome) {
+	id := workItem.GoodsID
+	body, outcome := fetchBody(ctx, proxy.Client, p.buff.GoodsInfo(workItem.Game, id), id)
+	if body == nil {
+		return nil, outcome
 	}
-	transformedItem := transformData(id, responseData)
-	formattedData, err := json.MarshalIndent(transformedItem, "", "  ")
-	if err != nil {
-		nonCookieParsingLogger.WithError(err).Error("Error marshaling transformed item for printing")
-		return
+	if outcome, ok := p.checkSchema(schemaDrift.EndpointGoodsInfo, goodsInfoSchema, body, proxy, id); !ok {
+		return nil, outcome
 	}
 
-	// Send the processed ID to the localhost server without using a proxy.
-	client := &http.Client{} // This client doesn't use a proxy
-
-	req, err := http.NewRequest("POST", "http://localhost/items", bytes.NewBuffer(formattedData))
+	response, err := decodeGoodsInfo(body)
 	if err != nil {
-		nonCookieParsingLogger.WithError(err).Error("Error creating request")
-		return
+		nonCookieParsingLogger.WithError(err).Errorf("Error decoding goods info of goodsId %s", id)
+		// A body that isn't JSON usually comes from the proxy, a field of unexpected type from Buff
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) && parseErr.Path != "" {
+			return nil, utils.OutcomeSuccess
+		}
+		return nil, utils.OutcomeError
+	}
+	// From here Buff has answered through the proxy, so problems are with the item, not the proxy
+	if response.Code != "OK" {
+		nonCookieParsingLogger.Errorf("Response code for goodsId %s is %q, not 'OK'", id, response.Code)
+		return nil, utils.OutcomeSuccess
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+jwtToken)
-	resp, err = client.Do(req)
+	if response.Data == nil {
+		nonCookieParsingLogger.WithError(&ParseError{Path: "data", Err: errors.New("missing")}).Errorf("Error processing goods info of goodsId %s", id)
+		return nil, utils.OutcomeSuccess
+	}
+
+	item, err := transformData(workItem, response.Data, p.buff.SellOrders(workItem.Game, id))
 	if err != nil {
-		nonCookieParsingLogger.WithError(err).Error("Error sending processed item")
-		return
+		nonCookieParsingLogger.WithError(err).Errorf("Skipping goodsId %s", id)
+		return nil, utils.OutcomeSuccess
 	}
-	defer resp.Body.Close()
+	return item, utils.OutcomeSuccess
+}
 
-	if resp.StatusCode != http.StatusOK {
-		nonCookieParsingLogger.Errorf("Received non-OK response: %s", resp.Status)
+// fetchBuyOrders gets the buy order book of the item through the proxy.
+// It returns nil if the book couldn't be fetched, the error is logged.
+func (p *nonCookieParser) fetchBuyOrders(ctx context.Context, proxy *utils.Proxy, workItem backend.WorkItem) ([]buyOrders.BuyOrder, utils.Outcome) {
+	id := workItem.GoodsID
+	body, outcome := fetchBody(ctx, proxy.Client, p.buff.BuyOrders(workItem.Game, id), id)
+	if body == nil {
+		return nil, outcome
 	}
+	if outcome, ok := p.checkSchema(schemaDrift.EndpointBuyOrder, buyOrders.Schema, body, proxy, id); !ok {
+		return nil, outcome
+	}
+	book, err := buyOrders.Parse(body)
+	if err != nil {
+		nonCookieParsingLogger.WithError(err).Errorf("Error parsing buy orders for goodsId %s", id)
+		var codeErr *buyOrders.CodeError
+		if errors.As(err, &codeErr) {
+			return nil, utils.OutcomeSuccess
+		}
+		return nil, utils.OutcomeError
+	}
+	return book, utils.OutcomeSuccess
 }
 
-func StartNonCookieParsing() error {
+// StartNonCookieParsing parses items through proxies until ctx is done. Items in flight
+// get config.ShutdownTimeout to finish before their requests are aborted. Every buff163 request is built
+// and sent with buff.
+func StartNonCookieParsing(ctx context.Context, config *configManager.Config, backendClient *backend.Client, buff *upstream.Buff) error {
+	workCtx, abort := shutdown.AbortAfter(ctx, config.ShutdownTimeout)
+	defer abort()
+
 	// Initializing nonCookieParsingLogger
 	nonCookieParsingLogger.Info("nonCookie parsing started!")
-	//// Step 1: Authenticate and get the JWT token.
-	//jwtToken, err := Authenticate()
-	jwtToken, err1 := "", []string(nil)
-	if err1 != nil {
-		//nonCookieParsingLogger.WithError(err1).Errorf('Authentication with backend failed')
-		return fmt.Errorf("error authenticating %s", err1)
+
+	nonCookieConfig := &config.NonCookieParsing
+	proxyPool := utils.NewProxyPool(utils.ProxyPoolSettings{
+		Delay:            nonCookieConfig.ProxyDelay,
+		FailureThreshold: nonCookieConfig.ProxyFailureThreshold,
+		QuarantineBase:   nonCookieConfig.ProxyQuarantineBase,
+		QuarantineMax:    nonCookieConfig.ProxyQuarantineMax,
+		Timeouts:         proxyDialer.TimeoutsFromConfig(config.HTTP),
+		WrapTransport:    buff.RoundTripper,
+	})
+	converter, err := prices.NewConverter(config.Currency)
+	if err != nil {
+		nonCookieParsingLogger.WithError(err).Error("Error loading currency rates")
+		return fmt.Errorf("error loading currency rates: %s", err)
+	}
+	go converter.Refresh(ctx)
+	parser := &nonCookieParser{
+		backendClient: backendClient,
+		proxyPool:     proxyPool,
+		drift:         schemaDrift.NewDetector(config.SchemaDrift),
+		converter:     converter,
+		config:        nonCookieConfig,
+		buff:          buff,
 	}
-	const N = 100 //TODO move to config. Number of items to notify if they were parsed
-	processedCount := 0
 
 	for {
-		//Step 2: Fetch all missing buff IDs.
-		allIDs, err := utils.FetchMissingBuffIDs(jwtToken)
+		//Step 1: Fetch all missing buff IDs.
+		allIDs, err := backendClient.MissingBuffIDs(ctx)
+		if ctx.Err() != nil {
+			nonCookieParsingLogger.Info("nonCookie parsing stopped")
+			return nil
+		}
 		if err != nil {
 			nonCookieParsingLogger.WithError(err).Errorf("Fetching of missing buffIds failed")
 			return fmt.Errorf("error fetching missing buff IDs %s", err)
@@ -120,7 +207,7 @@ func StartNonCookieParsing() error {
 
 		if len(allIDs) == 0 {
 			nonCookieParsingLogger.Info("No missing buff IDs found. Sleeping for 10 minutes.")
-			time.Sleep(10 * time.Minute)
+			shutdown.Sleep(ctx, 10*time.Minute)
 			continue
 		}
 
@@ -132,49 +219,32 @@ func StartNonCookieParsing() error {
 		//allIDs := []string{"42917"}
 		nonCookieParsingLogger.Infof("Total missing buff IDs fetched %d", len(allIDs))
 
-		//Step 3: initializing proxies. Fetching them from backend and setting counter of usage
-		numberOfProxies, err := utils.InitProxies(jwtToken)
-		if err != nil {
+		//Step 2: initializing proxies. Fetching them from backend
+		proxies, err := utils.InitProxies(ctx, backendClient)
+		if ctx.Err() != nil {
+			nonCookieParsingLogger.Info("nonCookie parsing stopped")
+			return nil
+		}
+		if len(proxies) == 0 {
 			nonCookieParsingLogger.WithError(err).Errorf("Error fetching parsing proxies")
 			return fmt.Errorf("error fetching parsing proxies: %s", err)
 		}
-
-		nonCookieParsingLogger.Infof("Total proxies fetched %d", numberOfProxies)
-
-		// Step 3: Process the IDs in batches.
-		for len(allIDs) > 0 {
-			if len(allIDs) < numberOfProxies {
-				numberOfProxies = len(allIDs)
-			}
-
-			// Process a batch of IDs.
-			workerFunction(jwtToken, allIDs[:numberOfProxies])
-			// Remove the processed IDs from the list.
-			allIDs = allIDs[numberOfProxies:]
-			processedCount += len(allIDs[:numberOfProxies])
-			if processedCount >= N {
-				nonCookieParsingLogger.Infof("%d buffIds have been processed, %d left", processedCount, len(allIDs))
-				processedCount = 0 // Reset the counter
-			}
-			//TODO pass to config
-			time.Sleep(3 * time.Second)
+		if err != nil {
+			nonCookieParsingLogger.WithError(err).Warn("Some parsing proxies are invalid")
 		}
-	}
-	return nil
-}
-
-func workerFunction(jwtToken string, ids []string) {
-	var wg sync.WaitGroup
 
-	// For each ID in the current batch, launch a separate goroutine.
+		nonCookieParsingLogger.Infof("Total proxies fetched %d", len(proxies))
+		if err := proxyPool.SetProxies(proxies); err != nil {
+			nonCookieParsingLogger.WithError(err).Warn("Some parsing proxies were left out of the pool")
+		}
 
-	for i := 0; i < len(ids); i++ {
-		wg.Add(1)
-		go func(id string) {
-			defer wg.Done()
-			processAndSendItem(jwtToken, id)
-		}(ids[i])
+		// Step 3: Stream the IDs through the proxies.
+		workers := nonCookieConfig.Workers
+		if workers == 0 {
+			workers = len(proxies)
+		}
+		uploaded := parser.runPipeline(ctx, workCtx, allIDs, workers)
+		nonCookieParsingLogger.Infof("%d of %d buffIds have been processed", uploaded, len(allIDs))
+		logPoolHealth(proxyPool)
 	}
-	// Wait for all goroutines to complete.
-	wg.Wait()
 }
@@ -0,0 +1,115 @@
+package nonCookieParsing_test
+
+import (
+	"buff163Parser/pkg/mockBackend"
+	"buff163Parser/pkg/mockBuff"
+	"buff163Parser/pkg/model"
+	"buff163Parser/pkg/nonCookieParsing"
+	"buff163Parser/pkg/testEnv"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// modeConfig has the settings of nonCookie parsing, the rest come from testEnv
+const modeConfig = `
+mode: nonCookieParsing
+non_cookie_parsing:
+  workers: 2
+  proxy_delay: 10ms
+  proxy_failure_threshold: 3
+  proxy_quarantine_base: 1s
+  proxy_quarantine_max: 1s
+  buy_orders: true
+`
+
+func TestNonCookieParsing(t *testing.T) {
+	env := testEnv.New(t, modeConfig)
+	buff, fakeBackend := env.Buff, env.Backend
+	quarantineDir := env.Config.SchemaDrift.QuarantineDir
+
+	fakeBackend.SetProxies(buff.ProxyURL())
+	fakeBackend.AddMissingBuffIDsRound("1001", "1002", "1003", `{"id": 1004, "game": "dota2"}`)
+	buff.Script(mockBuff.PathGoodsInfo, "1002", mockBuff.TooManyRequests())
+	buff.Script(mockBuff.PathGoodsInfo, "1003", mockBuff.Drifted())
+	buff.Script(mockBuff.PathBuyOrder, "1004", mockBuff.Malformed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- nonCookieParsing.StartNonCookieParsing(ctx, env.Config, env.BackendClient, env.Upstream)
+	}()
+	// The second request for missing buff IDs is made once the first round is uploaded
+	deadline := time.Now().Add(10 * time.Second)
+	for fakeBackend.Calls(mockBackend.PathMissingBuffIDs) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("nonCookie parsing didn't finish the round in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("nonCookie parsing didn't stop")
+	}
+
+	items := make(map[string]model.ProcessedItem)
+	for _, posted := range fakeBackend.Posted(mockBackend.PathItems) {
+		var item model.ProcessedItem
+		if err := json.Unmarshal(posted, &item); err != nil {
+			t.Fatal(err)
+		}
+		items[item.GoodsID] = item
+	}
+	if len(items) != 2 {
+		t.Fatalf("posted %d items, want 1001 and 1004", len(items))
+	}
+
+	csgoItem, ok := items["1001"]
+	if !ok {
+		t.Fatal("item 1001 wasn't posted")
+	}
+	if csgoItem.MarketHashName != "AK-47 | Case Hardened (Factory New)" || csgoItem.ListingPrice != "1205.5" || csgoItem.Listings != 35 {
+		t.Errorf("item 1001 was posted as %s for %s with %d listings", csgoItem.MarketHashName, csgoItem.ListingPrice, csgoItem.Listings)
+	}
+	if len(csgoItem.FloatCategory) != 3 || len(csgoItem.StyleCategory) == 0 {
+		t.Errorf("item 1001 has %d float and %d style categories", len(csgoItem.FloatCategory), len(csgoItem.StyleCategory))
+	}
+	if len(csgoItem.BuyOrderBook) != 2 {
+		t.Errorf("item 1001 has %d buy orders, want 2", len(csgoItem.BuyOrderBook))
+	}
+	if csgoItem.ListingPriceConverted == nil || csgoItem.ListingPriceConverted.Normalized == nil {
+		t.Error("listing price of item 1001 isn't normalized")
+	}
+
+	// Items of games without paintwear have no float categories, a broken buy order book doesn't drop the item
+	dotaItem, ok := items["1004"]
+	if !ok {
+		t.Fatal("item 1004 wasn't posted")
+	}
+	if dotaItem.Game != "dota2" || len(dotaItem.FloatCategory) != 0 || dotaItem.BuyOrderBook != nil {
+		t.Errorf("dota2 item 1004 was posted as %s item with %d float categories and %d buy orders",
+			dotaItem.Game, len(dotaItem.FloatCategory), len(dotaItem.BuyOrderBook))
+	}
+	for _, request := range buff.Requests() {
+		if request.GoodsID == "1004" && !strings.Contains(request.Query, "game=dota2") {
+			t.Errorf("request to %s for item 1004 was sent without its game: %s", request.Path, request.Query)
+		}
+	}
+
+	quarantined, err := filepath.Glob(filepath.Join(quarantineDir, "goods_info", "*_1003.body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 1 {
+		t.Errorf("drifted goods info of 1003 was quarantined %d times, want once", len(quarantined))
+	}
+}
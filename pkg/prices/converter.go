@@ -0,0 +1,147 @@
+package prices
+
+import (
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/logger"
+	"buff163Parser/pkg/shutdown"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+)
+
+var pricesLogger = logger.Log.WithField("context", "prices")
+
+// ratesFile is the format of the rates file: prices of a unit of each currency in the canonical currency
+type ratesFile struct {
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Converter normalizes prices to the canonical currency. Rates come from the static table of the config,
+// rates from the rates file override them and are reloaded by Refresh. It's safe for concurrent use.
+type Converter struct {
+	config configManager.CurrencyConfig
+
+	mu          sync.RWMutex
+	rates       map[string]float64
+	missingRate map[string]bool
+}
+
+// NewConverter creates a converter with the static rates and the rates file of the config, if it's set
+func NewConverter(config configManager.CurrencyConfig) (*Converter, error) {
+	c := &Converter{config: config, missingRate: make(map[string]bool)}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SourceCurrency is the currency of buff163 prices that don't name their currency
+func (c *Converter) SourceCurrency() string {
+	return c.config.Source
+}
+
+// Canonical is the currency prices are normalized to
+func (c *Converter) Canonical() string {
+	return c.config.Canonical
+}
+
+// reload builds the rates from the static table and the rates file
+func (c *Converter) reload() error {
+	rates := make(map[string]float64, len(c.config.Rates)+1)
+	for currency, rate := range c.config.Rates {
+		rates[currency] = rate
+	}
+	if c.config.RatesFile != "" {
+		data, err := os.ReadFile(c.config.RatesFile)
+		if err != nil {
+			return fmt.Errorf("error reading rates file: %v", err)
+		}
+		var file ratesFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("error decoding rates file: %v", err)
+		}
+		for currency, rate := range file.Rates {
+			if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+				return fmt.Errorf("rates file has invalid rate %v for %s", rate, currency)
+			}
+			rates[currency] = rate
+		}
+	}
+	rates[c.config.Canonical] = 1
+
+	c.mu.Lock()
+	c.rates = rates
+	c.mu.Unlock()
+	return nil
+}
+
+// Refresh reloads the rates file every refresh interval until ctx is done. Failed reloads keep the old rates.
+func (c *Converter) Refresh(ctx context.Context) {
+	if c.config.RatesFile == "" {
+		return
+	}
+	for shutdown.Sleep(ctx, c.config.RefreshInterval) {
+		if err := c.reload(); err != nil {
+			pricesLogger.WithError(err).Error("Error reloading currency rates, the old rates are kept")
+		}
+	}
+}
+
+func (c *Converter) rate(currency string) (float64, bool) {
+	c.mu.RLock()
+	rate, ok := c.rates[currency]
+	c.mu.RUnlock()
+	if ok {
+		return rate, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.missingRate[currency] {
+		c.missingRate[currency] = true
+		pricesLogger.Warnf("No rate for %s, its prices aren't normalized to %s", currency, c.config.Canonical)
+	}
+	return 0, false
+}
+
+// Convert normalizes the price to the canonical currency
+func (c *Converter) Convert(price Price) Converted {
+	converted := Converted{Original: price}
+	if rate, ok := c.rate(price.Currency); ok {
+		normalized := price.convert(rate, c.config.Canonical)
+		converted.Normalized = &normalized
+	}
+	return converted
+}
+
+// ConvertAmount parses a buff163 amount in currency and normalizes it. Empty and invalid amounts return nil.
+func (c *Converter) ConvertAmount(amount, currency string) *Converted {
+	if amount == "" {
+		return nil
+	}
+	price, err := Parse(amount, currency)
+	if err != nil {
+		pricesLogger.WithError(err).Debug("Price isn't normalized")
+		return nil
+	}
+	converted := c.Convert(price)
+	return &converted
+}
+
+// ConvertSource is ConvertAmount for amounts in the source currency
+func (c *Converter) ConvertSource(amount string) *Converted {
+	return c.ConvertAmount(amount, c.config.Source)
+}
+
+// ConvertFloat normalizes an amount given as a float, e.g. a point of a price history.
+// It reports false when there is no rate for the currency.
+func (c *Converter) ConvertFloat(amount float64, currency string) (float64, bool) {
+	rate, ok := c.rate(currency)
+	if !ok {
+		return 0, false
+	}
+	return math.Round(amount*rate*minorUnitsPerUnit) / minorUnitsPerUnit, true
+}
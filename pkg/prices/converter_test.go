@@ -0,0 +1,146 @@
+package prices_test
+
+import (
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/prices"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newConverter(t *testing.T, config configManager.CurrencyConfig) *prices.Converter {
+	t.Helper()
+	converter, err := prices.NewConverter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return converter
+}
+
+// normalized returns the normalized minor units of amount, or false if it wasn't normalized
+func normalized(converter *prices.Converter, amount, currency string) (int64, bool) {
+	converted := converter.ConvertAmount(amount, currency)
+	if converted == nil || converted.Normalized == nil {
+		return 0, false
+	}
+	return converted.Normalized.MinorUnits, true
+}
+
+func TestConvert(t *testing.T) {
+	converter := newConverter(t, configManager.CurrencyConfig{
+		Canonical: "USD",
+		Source:    "CNY",
+		Rates:     map[string]float64{"CNY": 0.1385, "EUR": 1.08},
+	})
+	tests := []struct {
+		amount   string
+		currency string
+		minor    int64
+		ok       bool
+	}{
+		{"100", "CNY", 1385, true},
+		// 13.85 cents are rounded to the nearest minor unit after conversion
+		{"1", "CNY", 14, true},
+		{"0.5", "CNY", 7, true},
+		{"-1", "CNY", -14, true},
+		{"12.34", "USD", 1234, true},
+		{"10", "EUR", 1080, true},
+		{"10", "RUB", 0, false},
+		{"", "CNY", 0, false},
+		{"abc", "CNY", 0, false},
+	}
+	for _, test := range tests {
+		minor, ok := normalized(converter, test.amount, test.currency)
+		if ok != test.ok || minor != test.minor {
+			t.Errorf("%s %s normalized to %d (%v), want %d (%v)", test.amount, test.currency, minor, ok, test.minor, test.ok)
+		}
+	}
+
+	converted := converter.Convert(prices.Price{MinorUnits: 500, Currency: "RUB"})
+	if converted.Normalized != nil || converted.Original.MinorUnits != 500 {
+		t.Errorf("price without a rate was converted to %+v", converted)
+	}
+	if converted := converter.ConvertSource("100"); converted == nil || converted.Original.Currency != "CNY" {
+		t.Errorf("source amount was converted to %+v", converted)
+	}
+
+	if amount, ok := converter.ConvertFloat(172.5, "CNY"); !ok || amount != 23.89 {
+		t.Errorf("172.5 CNY normalized to %v (%v), want 23.89", amount, ok)
+	}
+	if _, ok := converter.ConvertFloat(1, "RUB"); ok {
+		t.Error("float amount without a rate was normalized")
+	}
+}
+
+func writeRates(t *testing.T, file, rates string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(rates), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRatesFileRefresh(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rates.json")
+	writeRates(t, file, `{"rates": {"CNY": 0.15}}`)
+	converter := newConverter(t, configManager.CurrencyConfig{
+		Canonical:       "USD",
+		Source:          "CNY",
+		Rates:           map[string]float64{"CNY": 0.14, "EUR": 1.08},
+		RatesFile:       file,
+		RefreshInterval: 10 * time.Millisecond,
+	})
+
+	// The rates file overrides the static rates, the rest of them stay
+	if minor, _ := normalized(converter, "100", "CNY"); minor != 1500 {
+		t.Errorf("100 CNY normalized to %d minor units, want 1500 from the rates file", minor)
+	}
+	if minor, _ := normalized(converter, "1", "EUR"); minor != 108 {
+		t.Errorf("1 EUR normalized to %d minor units, want 108 from the static rates", minor)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go converter.Refresh(ctx)
+
+	writeRates(t, file, `{"rates": {"CNY": 0.16}}`)
+	waitForMinor(t, converter, "100", "CNY", 1600)
+
+	// Broken files keep the last rates
+	writeRates(t, file, `{"rates": {"CNY": -1}}`)
+	time.Sleep(50 * time.Millisecond)
+	if minor, _ := normalized(converter, "100", "CNY"); minor != 1600 {
+		t.Errorf("100 CNY normalized to %d minor units after a broken rates file, want 1600", minor)
+	}
+	writeRates(t, file, `{"rates": {"CNY": 0.17}}`)
+	waitForMinor(t, converter, "100", "CNY", 1700)
+}
+
+func waitForMinor(t *testing.T, converter *prices.Converter, amount, currency string, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		minor, _ := normalized(converter, amount, currency)
+		if minor == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s %s normalized to %d minor units, want %d after the rates file was refreshed", amount, currency, minor, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInvalidRatesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rates.json")
+	writeRates(t, file, `{"rates": {"CNY": 0}}`)
+	_, err := prices.NewConverter(configManager.CurrencyConfig{Canonical: "USD", Source: "CNY", RatesFile: file})
+	if err == nil {
+		t.Error("converter was created with a zero rate")
+	}
+	_, err = prices.NewConverter(configManager.CurrencyConfig{Canonical: "USD", Source: "CNY", RatesFile: filepath.Join(t.TempDir(), "missing.json")})
+	if err == nil {
+		t.Error("converter was created without its rates file")
+	}
+}
@@ -0,0 +1,103 @@
+package prices
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// minorUnitsPerUnit is the number of minor units in a unit of every supported currency (cents, fen)
+const minorUnitsPerUnit = 100
+
+// Price is an amount of money in integer minor units, so prices are compared and converted without float drift
+type Price struct {
+	MinorUnits int64
+	Currency   string
+}
+
+// Parse reads a decimal amount like "12.5" as buff163 sends it. Digits beyond the minor unit are rounded half up.
+func Parse(amount, currency string) (Price, error) {
+	amount = strings.TrimSpace(amount)
+	negative := strings.HasPrefix(amount, "-")
+	units, fraction, _ := strings.Cut(strings.TrimPrefix(amount, "-"), ".")
+	if units == "" && fraction == "" {
+		return Price{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if units == "" {
+		units = "0"
+	}
+	for _, digits := range []string{units, fraction} {
+		for _, r := range digits {
+			if r < '0' || r > '9' {
+				return Price{}, fmt.Errorf("invalid amount %q", amount)
+			}
+		}
+	}
+
+	minor, err := strconv.ParseInt(units, 10, 64)
+	if err != nil {
+		return Price{}, fmt.Errorf("invalid amount %q: %v", amount, err)
+	}
+	// Room for the minor units and the rounding
+	if minor > (math.MaxInt64-minorUnitsPerUnit)/minorUnitsPerUnit {
+		return Price{}, fmt.Errorf("amount %q is out of range", amount)
+	}
+	fraction += "000"
+	cents, _ := strconv.ParseInt(fraction[:2], 10, 64)
+	minor = minor*minorUnitsPerUnit + cents
+	if fraction[2] >= '5' {
+		minor++
+	}
+	if negative {
+		minor = -minor
+	}
+	return Price{MinorUnits: minor, Currency: currency}, nil
+}
+
+// Amount formats the price as a decimal string with two digits after the point
+func (p Price) Amount() string {
+	sign := ""
+	minor := p.MinorUnits
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/minorUnitsPerUnit, minor%minorUnitsPerUnit)
+}
+
+func (p Price) String() string {
+	return p.Amount() + " " + p.Currency
+}
+
+// convert applies rate, the price of a unit of p's currency in the target currency
+func (p Price) convert(rate float64, currency string) Price {
+	return Price{MinorUnits: int64(math.Round(float64(p.MinorUnits) * rate)), Currency: currency}
+}
+
+type priceJSON struct {
+	Amount     string `json:"amount"`
+	MinorUnits int64  `json:"minor_units"`
+	Currency   string `json:"currency"`
+}
+
+func (p Price) MarshalJSON() ([]byte, error) {
+	return json.Marshal(priceJSON{Amount: p.Amount(), MinorUnits: p.MinorUnits, Currency: p.Currency})
+}
+
+func (p *Price) UnmarshalJSON(data []byte) error {
+	var decoded priceJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*p = Price{MinorUnits: decoded.MinorUnits, Currency: decoded.Currency}
+	return nil
+}
+
+// Converted is a price as buff163 sent it along with its value in the canonical currency.
+// Normalized is nil when there is no rate for the original currency.
+type Converted struct {
+	Original   Price  `json:"original"`
+	Normalized *Price `json:"normalized,omitempty"`
+}
@@ -0,0 +1,75 @@
+package prices_test
+
+import (
+	"buff163Parser/pkg/prices"
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount string
+		minor  int64
+		valid  bool
+	}{
+		{"12.5", 1250, true},
+		{"12.50", 1250, true},
+		{"12", 1200, true},
+		{"12.", 1200, true},
+		{".5", 50, true},
+		{" 0.07 ", 7, true},
+		{"-3.25", -325, true},
+		{"-0.5", -50, true},
+		// Digits beyond the minor unit are rounded half up, away from zero for negative amounts
+		{"1.234", 123, true},
+		{"1.235", 124, true},
+		{"1.2349", 123, true},
+		{"0.995", 100, true},
+		{"-1.005", -101, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{".", 0, false},
+		{"abc", 0, false},
+		{"12a", 0, false},
+		{"1.2.3", 0, false},
+		{"1,5", 0, false},
+		{"+1", 0, false},
+		{"--1", 0, false},
+		{"1e3", 0, false},
+		{"92233720368547758.07", 0, false},
+	}
+	for _, test := range tests {
+		price, err := prices.Parse(test.amount, "CNY")
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", test.amount, price)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) returned %v", test.amount, err)
+			continue
+		}
+		if price.MinorUnits != test.minor || price.Currency != "CNY" {
+			t.Errorf("Parse(%q) = %d %s, want %d CNY", test.amount, price.MinorUnits, price.Currency, test.minor)
+		}
+	}
+}
+
+func TestPriceJSON(t *testing.T) {
+	price := prices.Price{MinorUnits: -705, Currency: "USD"}
+	data, err := json.Marshal(price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"amount":"-7.05","minor_units":-705,"currency":"USD"}`; string(data) != want {
+		t.Errorf("price was encoded as %s, want %s", data, want)
+	}
+	var decoded prices.Price
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != price {
+		t.Errorf("price was decoded as %v, want %v", decoded, price)
+	}
+}
@@ -0,0 +1,231 @@
+package schemaDrift
+
+import (
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/logger"
+	"buff163Parser/pkg/proxyDialer"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var schemaDriftLogger = logger.Log.WithField("context", "schemaDrift")
+
+// Endpoint names of buff163 APIs, used in logs and as quarantine subdirectories
+const (
+	EndpointGoodsInfo    = "goods_info"
+	EndpointSellOrder    = "sell_order"
+	EndpointBuyOrder     = "buy_order"
+	EndpointPriceHistory = "price_history"
+	EndpointBillOrder    = "bill_order"
+)
+
+// DriftError is returned by Check when a response doesn't match the schema. The response is quarantined.
+type DriftError struct {
+	Endpoint string
+	Problems []string
+	// NotJSON is set when the body isn't JSON at all, e.g. an HTML challenge page or a truncated body
+	NotJSON bool
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("%s response doesn't match the expected schema: %s", e.Endpoint, strings.Join(e.Problems, "; "))
+}
+
+// Metadata tells where a response came from
+type Metadata struct {
+	GoodsID string
+	Account int
+	// Proxy is written to disk without credentials
+	Proxy string
+}
+
+// quarantineRecord is written next to the quarantined body
+type quarantineRecord struct {
+	Endpoint  string    `json:"endpoint"`
+	GoodsID   string    `json:"goods_id,omitempty"`
+	Account   int       `json:"account,omitempty"`
+	Proxy     string    `json:"proxy,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Problems  []string  `json:"problems"`
+	Unknown   []string  `json:"unknown_fields,omitempty"`
+	BodyFile  string    `json:"body_file"`
+}
+
+type endpointState struct {
+	quarantined   int
+	sinceWarning  int
+	lastWarningAt time.Time
+	knownUnknown  map[string]bool
+}
+
+// Detector checks buff163 responses against schemas, quarantines responses that drifted
+// and warns about drift at most once per warn interval for each endpoint. It's safe for concurrent use.
+type Detector struct {
+	config configManager.SchemaDriftConfig
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointState
+}
+
+func NewDetector(config configManager.SchemaDriftConfig) *Detector {
+	return &Detector{config: config, endpoints: make(map[string]*endpointState)}
+}
+
+// Check checks body of a response of the endpoint against the schema. Responses with a code other than OK
+// are buff163 errors of a different shape and aren't checked. Drift, including a body that isn't JSON,
+// is returned as *DriftError after the body is quarantined. New fields are logged at debug level once per endpoint and path.
+func (d *Detector) Check(endpoint string, schema *Schema, body []byte, metadata Metadata) error {
+	var envelope struct {
+		Code interface{} `json:"code"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return d.notJSON(endpoint, body, metadata, err)
+	}
+	if code, ok := envelope.Code.(string); ok && code != "OK" {
+		return nil
+	}
+
+	result, err := schema.Check(body)
+	if err != nil {
+		return d.notJSON(endpoint, body, metadata, err)
+	}
+	d.noteUnknown(endpoint, result.Unknown)
+	if len(result.Problems) == 0 {
+		return nil
+	}
+
+	d.quarantine(endpoint, body, metadata, result)
+	return &DriftError{Endpoint: endpoint, Problems: result.Problems}
+}
+
+// notJSON quarantines a body that couldn't be decoded
+func (d *Detector) notJSON(endpoint string, body []byte, metadata Metadata, err error) error {
+	result := Result{Problems: []string{fmt.Sprintf("body is not JSON: %v", err)}}
+	d.quarantine(endpoint, body, metadata, result)
+	return &DriftError{Endpoint: endpoint, Problems: result.Problems, NotJSON: true}
+}
+
+func (d *Detector) state(endpoint string) *endpointState {
+	state, ok := d.endpoints[endpoint]
+	if !ok {
+		state = &endpointState{knownUnknown: make(map[string]bool)}
+		d.endpoints[endpoint] = state
+	}
+	return state
+}
+
+// noteUnknown logs fields the schema doesn't know, each one once. Schemas list only the fields the parser reads,
+// so most of them are fields Buff always sends and they're logged at debug level
+func (d *Detector) noteUnknown(endpoint string, unknown []string) {
+	if len(unknown) == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.state(endpoint)
+	for _, path := range unknown {
+		if state.knownUnknown[path] {
+			continue
+		}
+		state.knownUnknown[path] = true
+		schemaDriftLogger.WithField("endpoint", endpoint).Debugf("Response has a field the schema doesn't know: %s", path)
+	}
+}
+
+// quarantine writes the body and its metadata to the quarantine directory and warns about the drift
+func (d *Detector) quarantine(endpoint string, body []byte, metadata Metadata, result Result) {
+	d.mu.Lock()
+	state := d.state(endpoint)
+	state.sinceWarning++
+	write := state.quarantined < d.config.MaxQuarantined
+	if write {
+		state.quarantined++
+	}
+	warn := time.Since(state.lastWarningAt) >= d.config.WarnInterval
+	sinceWarning := state.sinceWarning
+	if warn {
+		state.sinceWarning = 0
+		state.lastWarningAt = time.Now()
+	}
+	d.mu.Unlock()
+
+	entry := schemaDriftLogger.WithField("endpoint", endpoint)
+	if warn {
+		entry.Warnf("Schema drift: %d responses didn't match the schema since the last warning, e.g. %s",
+			sinceWarning, strings.Join(result.Problems, "; "))
+	} else {
+		entry.Debugf("Schema drift: %s", strings.Join(result.Problems, "; "))
+	}
+	if !write {
+		return
+	}
+
+	if err := d.write(endpoint, body, metadata, result); err != nil {
+		entry.WithError(err).Error("Error quarantining response")
+	}
+}
+
+func (d *Detector) write(endpoint string, body []byte, metadata Metadata, result Result) error {
+	dir := filepath.Join(d.config.QuarantineDir, endpoint)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%d", now.UnixNano())
+	if metadata.GoodsID != "" {
+		name += "_" + sanitize(metadata.GoodsID)
+	}
+	bodyFile := name + ".body"
+	if err := os.WriteFile(filepath.Join(dir, bodyFile), body, 0644); err != nil {
+		return err
+	}
+
+	record := quarantineRecord{
+		Endpoint:  endpoint,
+		GoodsID:   metadata.GoodsID,
+		Account:   metadata.Account,
+		Proxy:     redactProxy(metadata.Proxy),
+		Timestamp: now,
+		Problems:  result.Problems,
+		Unknown:   result.Unknown,
+		BodyFile:  bodyFile,
+	}
+	recordData, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".json"), recordData, 0644)
+}
+
+// redactProxy keeps only the address of the proxy, it's written to disk
+func redactProxy(proxy string) string {
+	if proxy == "" {
+		return ""
+	}
+	parsed, err := url.Parse(proxy)
+	if err != nil || parsed.Host == "" {
+		return "<unparsable proxy>"
+	}
+	return proxyDialer.Address(parsed)
+}
+
+func sanitize(name string) string {
+	var sanitized bytes.Buffer
+	for _, r := range name {
+		if r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-' {
+			sanitized.WriteRune(r)
+		} else {
+			sanitized.WriteRune('_')
+		}
+	}
+	return sanitized.String()
+}
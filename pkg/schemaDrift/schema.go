@@ -0,0 +1,198 @@
+package schemaDrift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Kind is the expected JSON type of a value
+type Kind int
+
+const (
+	KindAny Kind = iota
+	KindString
+	KindNumber
+	// KindScalar is a string or a number, buff163 is not consistent about prices and ids
+	KindScalar
+	KindBool
+	KindObject
+	KindArray
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindNumber:
+		return "number"
+	case KindScalar:
+		return "string or number"
+	case KindBool:
+		return "bool"
+	case KindObject:
+		return "object"
+	case KindArray:
+		return "array"
+	default:
+		return "any"
+	}
+}
+
+// Schema describes the expected shape of a JSON value. Null is accepted for every value that isn't required.
+type Schema struct {
+	kind     Kind
+	required bool
+	fields   Fields
+	elem     *Schema
+}
+
+// Fields are the known fields of an object by name
+type Fields map[string]*Schema
+
+func Any() *Schema    { return &Schema{kind: KindAny} }
+func String() *Schema { return &Schema{kind: KindString} }
+func Number() *Schema { return &Schema{kind: KindNumber} }
+func Scalar() *Schema { return &Schema{kind: KindScalar} }
+func Bool() *Schema   { return &Schema{kind: KindBool} }
+
+// Object is an object with the known fields. Fields that aren't known are reported as unknown.
+func Object(fields Fields) *Schema {
+	return &Schema{kind: KindObject, fields: fields}
+}
+
+// Array is an array with elements of the elem schema
+func Array(elem *Schema) *Schema {
+	return &Schema{kind: KindArray, elem: elem}
+}
+
+// Required marks the value as one that must be present and not null
+func Required(schema *Schema) *Schema {
+	required := *schema
+	required.required = true
+	return &required
+}
+
+// Result of checking a value against a schema
+type Result struct {
+	// Problems are missing required fields and values of unexpected type, by path like data.items[3].price
+	Problems []string
+	// Unknown are paths of fields the schema doesn't know, with array indexes dropped like data.items[].new_field
+	Unknown []string
+}
+
+// Check decodes body and checks it against the schema. It returns an error only if body isn't JSON.
+func (s *Schema) Check(body []byte) (Result, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	unknown := make(map[string]bool)
+	s.check(value, "", "", &result, unknown)
+	for path := range unknown {
+		result.Unknown = append(result.Unknown, path)
+	}
+	sort.Strings(result.Unknown)
+	return result, nil
+}
+
+func (s *Schema) check(value interface{}, path, genericPath string, result *Result, unknown map[string]bool) {
+	if value == nil {
+		if s.required {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: required %s is missing", displayPath(path), s.kind))
+		}
+		return
+	}
+
+	switch s.kind {
+	case KindString:
+		if _, ok := value.(string); !ok {
+			result.Problems = append(result.Problems, typeProblem(path, s.kind, value))
+		}
+	case KindNumber:
+		if _, ok := value.(json.Number); !ok {
+			result.Problems = append(result.Problems, typeProblem(path, s.kind, value))
+		}
+	case KindScalar:
+		switch value.(type) {
+		case string, json.Number:
+		default:
+			result.Problems = append(result.Problems, typeProblem(path, s.kind, value))
+		}
+	case KindBool:
+		if _, ok := value.(bool); !ok {
+			result.Problems = append(result.Problems, typeProblem(path, s.kind, value))
+		}
+	case KindObject:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			result.Problems = append(result.Problems, typeProblem(path, s.kind, value))
+			return
+		}
+		names := make([]string, 0, len(s.fields))
+		for name := range s.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s.fields[name].check(object[name], joinPath(path, name), joinPath(genericPath, name), result, unknown)
+		}
+		for name := range object {
+			if _, known := s.fields[name]; !known {
+				unknown[joinPath(genericPath, name)] = true
+			}
+		}
+	case KindArray:
+		array, ok := value.([]interface{})
+		if !ok {
+			result.Problems = append(result.Problems, typeProblem(path, s.kind, value))
+			return
+		}
+		if s.elem == nil {
+			return
+		}
+		for i, elem := range array {
+			s.elem.check(elem, fmt.Sprintf("%s[%d]", path, i), genericPath+"[]", result, unknown)
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "response"
+	}
+	return path
+}
+
+func typeProblem(path string, expected Kind, value interface{}) string {
+	return fmt.Sprintf("%s: expected %s, got %s", displayPath(path), expected, jsonKind(value))
+}
+
+func jsonKind(value interface{}) Kind {
+	switch value.(type) {
+	case string:
+		return KindString
+	case json.Number:
+		return KindNumber
+	case bool:
+		return KindBool
+	case map[string]interface{}:
+		return KindObject
+	case []interface{}:
+		return KindArray
+	default:
+		return KindAny
+	}
+}
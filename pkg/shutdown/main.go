@@ -0,0 +1,39 @@
+package shutdown
+
+import (
+	"context"
+	"time"
+)
+
+// AbortAfter returns a context that is canceled timeout after ctx is done.
+// Workers use it to finish in-flight work after a stop signal, but not forever.
+func AbortAfter(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	abortCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+		case <-abortCtx.Done():
+			return
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-abortCtx.Done():
+		}
+	}()
+	return abortCtx, cancel
+}
+
+// Sleep pauses for d or until ctx is done. It reports whether the whole duration has passed.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
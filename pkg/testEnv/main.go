@@ -0,0 +1,78 @@
+package testEnv
+
+import (
+	"buff163Parser/pkg/backend"
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/mockBackend"
+	"buff163Parser/pkg/mockBuff"
+	"buff163Parser/pkg/upstream"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// baseConfig has the settings every end-to-end test shares, the tests add the ones of their mode
+const baseConfig = `
+backend_apikey_env: BUFF_PARSER_API_KEY
+shutdown_timeout: 5s
+backend:
+  base_url: %s
+buff:
+  base_url: %s
+http:
+  request_timeout: 10s
+schema_drift:
+  quarantine_dir: %s
+currency:
+  canonical: USD
+  source: CNY
+  rates:
+    CNY: 0.14
+`
+
+// Env is a fake buff163 and a fake backend the parser is run against, with a config pointing at them
+type Env struct {
+	Buff          *mockBuff.Server
+	Backend       *mockBackend.Backend
+	Config        *configManager.Config
+	BackendClient *backend.Client
+	// Upstream sends buff163 requests to Buff through its proxies
+	Upstream *upstream.Buff
+}
+
+// New starts the fakes and loads the base config followed by modeConfig, the YAML with the mode
+// and its settings. Everything is stopped when the test ends.
+func New(t *testing.T, modeConfig string) *Env {
+	t.Helper()
+	buff, err := mockBuff.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(buff.Close)
+	fakeBackend := mockBackend.NewBackend()
+	t.Cleanup(fakeBackend.Close)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	configYAML := fmt.Sprintf(baseConfig, fakeBackend.URL(), buff.URL(), filepath.Join(dir, "quarantine")) + modeConfig
+	if err := os.WriteFile(configPath, []byte(configYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffUpstream, err := upstream.New(config.Buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffUpstream.Transport = buff.WrapTransport
+	return &Env{
+		Buff:          buff,
+		Backend:       fakeBackend,
+		Config:        config,
+		BackendClient: backend.NewClient(&config.Backend, backend.NewAuthenticator(&config.Backend, mockBackend.APIKey)),
+		Upstream:      buffUpstream,
+	}
+}
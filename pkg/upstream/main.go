@@ -0,0 +1,127 @@
+package upstream
+
+import (
+	"buff163Parser/pkg/configManager"
+	"buff163Parser/pkg/games"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Buff is buff163 as the parsers see it: the base URL and path templates every request is built with,
+// and an optional transport wrapper every request is sent through. It lets the parsers use a mirror,
+// a recording proxy or a local fake instead of buff.163.com.
+type Buff struct {
+	config  configManager.BuffConfig
+	baseURL *url.URL
+	// Transport, if set, wraps the transport of every buff163 request, the one sending it through the proxy
+	// of the account or of the pool. The wrapper may pass requests on, e.g. to record them, or answer them itself.
+	Transport func(proxied http.RoundTripper) http.RoundTripper
+}
+
+// New returns buff163 of the config, it's expected to be loaded with configManager.LoadConfig
+func New(config configManager.BuffConfig) (*Buff, error) {
+	if config.BaseURL == "" {
+		return nil, fmt.Errorf("buff base_url is required")
+	}
+	baseURL, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing buff base_url: %v", err)
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+	baseURL.RawPath = ""
+	return &Buff{config: config, baseURL: baseURL}, nil
+}
+
+// RoundTripper returns the transport to send buff163 requests with in place of the proxied one
+func (b *Buff) RoundTripper(proxied http.RoundTripper) http.RoundTripper {
+	if b.Transport == nil {
+		return proxied
+	}
+	return b.Transport(proxied)
+}
+
+// CookieURL is the URL account cookies are stored for
+func (b *Buff) CookieURL() *url.URL {
+	return &url.URL{Scheme: b.baseURL.Scheme, Host: b.baseURL.Host, Path: "/"}
+}
+
+// URL builds the link of the endpoint for the item, placeholders of the path template are replaced
+func (b *Buff) URL(endpoint string, game games.Game, goodsID string, query url.Values) string {
+	replacer := strings.NewReplacer("{goods_id}", url.PathEscape(goodsID), "{game}", url.PathEscape(string(game)))
+	link := b.baseURL.String() + replacer.Replace(b.config.Path(endpoint))
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+func itemQuery(game games.Game, goodsID string) url.Values {
+	return url.Values{"game": {string(game)}, "goods_id": {goodsID}}
+}
+
+// GoodsPage returns the link of the web page of the item
+func (b *Buff) GoodsPage(game games.Game, goodsID string) string {
+	return b.URL(configManager.BuffGoodsPage, game, goodsID, nil)
+}
+
+// GoodsInfo returns the link of goods info of the item
+func (b *Buff) GoodsInfo(game games.Game, goodsID string) string {
+	return b.URL(configManager.BuffGoodsInfo, game, goodsID, itemQuery(game, goodsID))
+}
+
+// SellOrders returns the link of the first page of sell orders of the item, categories add their filters to it
+func (b *Buff) SellOrders(game games.Game, goodsID string) string {
+	query := itemQuery(game, goodsID)
+	query.Set("page_num", "1")
+	query.Set("sort_by", "default")
+	query.Set("mode", "")
+	query.Set("allow_tradable_cooldown", "1")
+	return b.URL(configManager.BuffSellOrder, game, goodsID, query)
+}
+
+// BuyOrders returns the link of the first page of the buy order book of the item, the highest prices go first
+func (b *Buff) BuyOrders(game games.Game, goodsID string) string {
+	query := itemQuery(game, goodsID)
+	query.Set("page_num", "1")
+	return b.URL(configManager.BuffBuyOrder, game, goodsID, query)
+}
+
+// PriceHistory returns the link of the price history of the item for a window of days
+func (b *Buff) PriceHistory(game games.Game, goodsID, currency string, days, priceType int) string {
+	query := itemQuery(game, goodsID)
+	query.Set("currency", currency)
+	query.Set("days", strconv.Itoa(days))
+	query.Set("buff_price_type", strconv.Itoa(priceType))
+	query.Set("with_sell_num", "true")
+	return b.URL(configManager.BuffPriceHistory, game, goodsID, query)
+}
+
+// BillOrders returns the link of the recent sales of the item
+func (b *Buff) BillOrders(game games.Game, goodsID string) string {
+	return b.URL(configManager.BuffBillOrder, game, goodsID, itemQuery(game, goodsID))
+}
+
+// Rebase moves a stored buff163 API link, like the sell order link of a category, onto the base URL
+// and path templates of b. The query is kept. Links of paths b doesn't know keep their path.
+func (b *Buff) Rebase(link string) (string, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("error parsing buff163 link: %v", err)
+	}
+	path := parsed.Path
+	for _, endpoint := range []string{configManager.BuffGoodsInfo, configManager.BuffSellOrder, configManager.BuffBuyOrder,
+		configManager.BuffPriceHistory, configManager.BuffBillOrder} {
+		if strings.HasSuffix(path, configManager.DefaultBuffPath(endpoint)) || strings.HasSuffix(path, b.config.Path(endpoint)) {
+			path = b.config.Path(endpoint)
+			break
+		}
+	}
+	rebased := b.baseURL.String() + path
+	if parsed.RawQuery != "" {
+		rebased += "?" + parsed.RawQuery
+	}
+	return rebased, nil
+}